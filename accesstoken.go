@@ -0,0 +1,82 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	AccessTokenTyp = "at+jwt" // rfc9068 access token的header.typ
+)
+
+var (
+	ErrInvalidTokenType = errors.New("invalid token type")
+)
+
+// rfc9068要求的字段
+var accessTokenClaims = []string{"iss", "exp", "aud", "sub", "client_id", "iat", "jti"}
+
+// 签发rfc9068 access token，header.typ设置成at+jwt，
+// payload必须有iss，exp，aud，sub和client_id，iat和jti没有会自动填充
+func SignAccessToken(alg Alg, header, payload Claims, provider Provider) (string, error) {
+	payload, err := setPayloadDefault(payload, configOf(provider))
+	if err != nil {
+		return "", err
+	}
+	err = checkAccessTokenClaims(payload)
+	if err != nil {
+		return "", err
+	}
+	header = copyClaims(header, 1)
+	header["typ"] = AccessTokenTyp
+	return Sign(alg, header, payload, provider)
+}
+
+func checkAccessTokenClaims(payload Claims) error {
+	for _, name := range accessTokenClaims {
+		if v, ok := payload[name]; !ok || v == nil || v == "" {
+			return fmt.Errorf("missing claim <%s>", name)
+		}
+	}
+	if len(claimStrings(payload, "aud")) < 1 {
+		return fmt.Errorf("missing claim <aud>")
+	}
+	return nil
+}
+
+// typ是at+jwt或者application/at+jwt
+func isAccessTokenTyp(header Claims) bool {
+	typ, _ := header["typ"].(string)
+	typ = strings.ToLower(typ)
+	return typ == AccessTokenTyp || typ == "application/"+AccessTokenTyp
+}
+
+// rfc9068 access token验证
+type AccessTokenValidator struct {
+	Provider Provider // 签名验证
+	Issuer   string   // 必须和iss相同
+	Audience string   // 必须在aud中
+}
+
+// 验证access token，typ不是at+jwt的token，比如id token，会被拒绝
+func (v *AccessTokenValidator) Validate(token string) (header, payload Claims, err error) {
+	header, payload, err = Verify(token, v.Provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isAccessTokenTyp(header) {
+		return nil, nil, ErrInvalidTokenType
+	}
+	err = checkAccessTokenClaims(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload["iss"] != v.Issuer {
+		return nil, nil, ErrInvalidIssuer
+	}
+	if !containsString(claimStrings(payload, "aud"), v.Audience) {
+		return nil, nil, ErrInvalidAudience
+	}
+	return
+}
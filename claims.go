@@ -1,11 +1,29 @@
 package jwt
 
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"time"
+)
+
 type Claims map[string]interface{}
 
+// jose header
 type Header Claims
 
+// 负载，注册字段(iss/sub/aud/exp/nbf/iat/jti)的设置方法在这里
 type Payload Claims
 
+func NewHeader() Header {
+	return make(Header)
+}
+
+func NewPayload() Payload {
+	return make(Payload)
+}
+
 func (h Header) SetHS256ALG() {
 	h["alg"] = "HS256"
 }
@@ -58,30 +76,101 @@ func (h Header) SetTYP() {
 	h["typ"] = "JWT"
 }
 
-func (h Header) SetISS(iss interface{}) {
-	h["iss"] = iss
+func (h Header) SetKID(kid string) {
+	h["kid"] = kid
+}
+
+func (h Header) SetCTY(cty string) {
+	h["cty"] = cty
+}
+
+// crit里的字段必须是接收方能理解的扩展header
+func (h Header) SetCRIT(crit ...string) {
+	h["crit"] = crit
+}
+
+// 证书DER的sha1指纹
+func (h Header) SetX5T(cert *x509.Certificate) {
+	sum := sha1.Sum(cert.Raw)
+	h["x5t"] = base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p Payload) SetISS(iss string) {
+	p["iss"] = iss
+}
+
+func (p Payload) SetSUB(sub string) {
+	p["sub"] = sub
+}
+
+// aud总是以数组的形式保存
+func (p Payload) SetAUD(aud ...string) {
+	p["aud"] = aud
+}
+
+// 当前时间加上ttl
+func (p Payload) SetEXP(ttl time.Duration) {
+	p["exp"] = DefaultConfig.now().Add(ttl).Unix()
+}
+
+func (p Payload) SetEXPAt(exp time.Time) {
+	p["exp"] = exp.Unix()
+}
+
+// 当前时间加上delay之后才生效
+func (p Payload) SetNBF(delay time.Duration) {
+	p["nbf"] = DefaultConfig.now().Add(delay).Unix()
+}
+
+func (p Payload) SetNBFAt(nbf time.Time) {
+	p["nbf"] = nbf.Unix()
 }
 
-func (h Header) SetSUB(sub interface{}) {
-	h["sub"] = sub
+// 当前时间
+func (p Payload) SetIAT() {
+	p["iat"] = DefaultConfig.now().Unix()
 }
 
-func (h Header) SetAUD(aud interface{}) {
-	h["aud"] = aud
+func (p Payload) SetIATAt(iat time.Time) {
+	p["iat"] = iat.Unix()
 }
 
-func (h Header) SetEXP(exp interface{}) {
-	h["exp"] = exp
+func (p Payload) SetJTI(jti string) {
+	p["jti"] = jti
 }
 
-func (h Header) SetNBF(nbf interface{}) {
-	h["nbf"] = nbf
+// 签名时，payload没有jti和iat就自动填充，
+// 填充在浅拷贝上，调用者的payload不变，重复使用也会得到不同的jti
+func setPayloadDefault(payload Claims, c *Config) (Claims, error) {
+	p := copyClaims(payload, 2)
+	if _, ok := p["iat"]; !ok {
+		p["iat"] = c.now().Unix()
+	}
+	if _, ok := p["jti"]; !ok {
+		jti, err := newJTI(c.random())
+		if err != nil {
+			return nil, err
+		}
+		p["jti"] = jti
+	}
+	return p, nil
 }
 
-func (h Header) SetIAT(iat interface{}) {
-	h["iat"] = iat
+// 浅拷贝，n是预留的字段数，签名时的自动填充写在拷贝上
+func copyClaims(c Claims, n int) Claims {
+	m := make(Claims, len(c)+n)
+	for k, v := range c {
+		m[k] = v
+	}
+	return m
 }
 
-func (h Header) SetJTI(jti interface{}) {
-	h["jti"] = jti
+// 16字节随机数的base64
+func newJTI(random io.Reader) (string, error) {
+	var b [16]byte
+	_, err := io.ReadFull(random, b[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:]), nil
 }
@@ -0,0 +1,118 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrConfirmation = errors.New("proof of possession failed")
+)
+
+// rfc7800 cnf.jwk，key是持有者的公钥
+func (p Payload) SetCNFJWK(key interface{}) error {
+	j, err := NewJWK(key, "", "")
+	if err != nil {
+		return err
+	}
+	j.Use = ""
+	p.setCNF("jwk", j)
+	return nil
+}
+
+// rfc9449 cnf.jkt，key是持有者的公钥
+func (p Payload) SetCNFJKT(key interface{}) error {
+	jkt, err := JKT(key)
+	if err != nil {
+		return err
+	}
+	p.setCNF("jkt", jkt)
+	return nil
+}
+
+// rfc8705 cnf.x5t#S256，cert是mtls的客户端证书
+func (p Payload) SetCNFX5T(cert *x509.Certificate) {
+	p.setCNF("x5t#S256", certThumbprint(cert))
+}
+
+func (p Payload) setCNF(name string, value interface{}) {
+	cnf, ok := p["cnf"].(map[string]interface{})
+	if !ok {
+		cnf = make(map[string]interface{})
+		p["cnf"] = cnf
+	}
+	cnf[name] = value
+}
+
+// 证书DER的sha256
+func certThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// 验证payload的cnf，key是请求出示的公钥，r是mtls请求，
+// cnf中的每一个绑定都必须满足，没有cnf返回ErrConfirmation
+func ValidateConfirmation(payload Claims, key interface{}, r *http.Request) error {
+	cnf, ok := payload["cnf"].(map[string]interface{})
+	if !ok || len(cnf) < 1 {
+		return ErrConfirmation
+	}
+	n := 0
+	// jwk和jkt
+	var jkt string
+	if key != nil {
+		var err error
+		jkt, err = JKT(key)
+		if err != nil {
+			return err
+		}
+	}
+	if v, ok := cnf["jwk"]; ok {
+		j, err := jwkOfClaim(v)
+		if err != nil {
+			return ErrConfirmation
+		}
+		s, err := j.Thumbprint(crypto.SHA256)
+		if err != nil || jkt == "" || s != jkt {
+			return ErrConfirmation
+		}
+		n++
+	}
+	if v, ok := cnf["jkt"]; ok {
+		if jkt == "" || v != jkt {
+			return ErrConfirmation
+		}
+		n++
+	}
+	// mtls证书
+	if v, ok := cnf["x5t#S256"]; ok {
+		if r == nil || r.TLS == nil || len(r.TLS.PeerCertificates) < 1 {
+			return ErrConfirmation
+		}
+		if v != certThumbprint(r.TLS.PeerCertificates[0]) {
+			return ErrConfirmation
+		}
+		n++
+	}
+	if n < 1 {
+		return ErrConfirmation
+	}
+	return nil
+}
+
+// Verify之后验证cnf
+func VerifyConfirmation(token string, provider Provider, key interface{}, r *http.Request) (header, payload Claims, err error) {
+	header, payload, err = Verify(token, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = ValidateConfirmation(payload, key, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return
+}
@@ -0,0 +1,213 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"hash"
+	"io"
+	"math/big"
+	"time"
+)
+
+var (
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+)
+
+// 时间来源
+type Clock interface {
+	Now() time.Time
+}
+
+// 函数形式的Clock
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// 签名，生成密钥和验证时使用的配置，
+// 注意Rand只是随机数的来源，rsa和ecdsa的GenerateKey不保证相同的Rand生成相同的key，
+// 需要可重复的签名结果时，es算法使用DeterministicES，key使用固定的key
+type Config struct {
+	Clock           Clock           // 时间来源，nil使用time.Now
+	Rand            io.Reader       // 随机数来源，nil使用crypto/rand.Reader
+	DeterministicES bool            // es算法使用rfc6979生成k，相同的输入得到相同的签名
+	Leeway          time.Duration   // 验证exp和nbf时允许的时钟误差
+	Revocation      RevocationStore // 不为nil，验证时检查jti是否已经吊销
+	Hooks           Hooks           // 不为nil，每次签名和验证之后调用
+}
+
+// 默认配置，Payload的时间设置方法也使用它
+var DefaultConfig = new(Config)
+
+// provider可以实现这个接口，提供自己的配置
+type ConfigProvider interface {
+	Config() *Config
+}
+
+// 获取provider的配置，没有就使用DefaultConfig
+func configOf(provider Provider) *Config {
+	if p, ok := provider.(ConfigProvider); ok {
+		if c := p.Config(); c != nil {
+			return c
+		}
+	}
+	return DefaultConfig
+}
+
+func (c *Config) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+func (c *Config) random() io.Reader {
+	if c.Rand == nil {
+		return rand.Reader
+	}
+	return c.Rand
+}
+
+// 验证payload的exp和nbf
+func (c *Config) ValidateTime(payload Claims) error {
+	now := c.now().Unix()
+	leeway := int64(c.Leeway / time.Second)
+	if exp, ok := claimInt64(payload, "exp"); ok && now > exp+leeway {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claimInt64(payload, "nbf"); ok && now+leeway < nbf {
+		return ErrTokenNotValidYet
+	}
+	return nil
+}
+
+// 签名验证通过之后，验证payload
+func (c *Config) validate(payload Claims) error {
+	err := c.ValidateTime(payload)
+	if err != nil {
+		return err
+	}
+	return checkRevoked(c.Revocation, payload)
+}
+
+// 读取数字类型的字段，json解码后是float64
+func claimInt64(claims Claims, name string) (int64, bool) {
+	switch v := claims[name].(type) {
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// 读取字符串或者字符串数组类型的字段，比如aud
+func claimStrings(claims Claims, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, i := range v {
+			if str, ok := i.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	default:
+		return nil
+	}
+}
+
+func containsString(s []string, str string) bool {
+	for _, v := range s {
+		if v == str {
+			return true
+		}
+	}
+	return false
+}
+
+// es签名，根据配置选择随机的k或者rfc6979的k
+func (c *Config) signES(key *ecdsa.PrivateKey, digest []byte, newHash func() hash.Hash) (r, s *big.Int, err error) {
+	if !c.DeterministicES {
+		return ecdsa.Sign(c.random(), key, digest)
+	}
+	return signRFC6979(key, digest, newHash)
+}
+
+// rfc6979确定性ecdsa签名，注意math/big不是常量时间的
+func signRFC6979(key *ecdsa.PrivateKey, digest []byte, newHash func() hash.Hash) (r, s *big.Int, err error) {
+	n := key.Curve.Params().N
+	qlen := n.BitLen()
+	rlen := (qlen + 7) / 8
+	// bits2int
+	bits2int := func(b []byte) *big.Int {
+		x := new(big.Int).SetBytes(b)
+		if d := len(b)*8 - qlen; d > 0 {
+			x.Rsh(x, uint(d))
+		}
+		return x
+	}
+	// int2octets
+	int2octets := func(x *big.Int) []byte {
+		b := make([]byte, rlen)
+		return x.FillBytes(b)
+	}
+	e := bits2int(digest)
+	h1 := new(big.Int).Mod(e, n)
+	x := int2octets(key.D)
+	h1b := int2octets(h1)
+	// 初始化V和K
+	size := newHash().Size()
+	v := make([]byte, size)
+	k := make([]byte, size)
+	for i := range v {
+		v[i] = 0x01
+	}
+	mac := func(key []byte, data ...[]byte) []byte {
+		h := hmac.New(newHash, key)
+		for _, d := range data {
+			h.Write(d)
+		}
+		return h.Sum(nil)
+	}
+	k = mac(k, v, []byte{0x00}, x, h1b)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, x, h1b)
+	v = mac(k, v)
+	for {
+		var t []byte
+		for len(t) < rlen {
+			v = mac(k, v)
+			t = append(t, v...)
+		}
+		kb := bits2int(t[:rlen])
+		if kb.Sign() > 0 && kb.Cmp(n) < 0 {
+			// r = (k*G).x mod n
+			px, _ := key.Curve.ScalarBaseMult(int2octets(kb))
+			r = new(big.Int).Mod(px, n)
+			if r.Sign() != 0 {
+				// s = k^-1 * (e + r*d) mod n
+				s = new(big.Int).Mul(r, key.D)
+				s.Add(s, e)
+				s.Mul(s, new(big.Int).ModInverse(kb, n))
+				s.Mod(s, n)
+				if s.Sign() != 0 {
+					return r, s, nil
+				}
+			}
+		}
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+}
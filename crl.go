@@ -0,0 +1,231 @@
+package jwt
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCertificateRevoked       = errors.New("certificate revoked")
+	ErrCertificateStatusUnknown = errors.New("certificate revocation status unknown")
+)
+
+// 查询不到证书状态时的策略
+type RevocationPolicy int
+
+const (
+	SoftFail RevocationPolicy = iota // 查询失败当作没有吊销
+	HardFail                         // 查询失败返回ErrCertificateStatusUnknown
+)
+
+// ocsp响应没有nextUpdate时的缓存时间
+const defaultOCSPCacheTTL = time.Hour
+
+// crl没有nextUpdate时的有效和缓存时间
+const defaultCRLCacheTTL = time.Hour
+
+func NewCertRevocationChecker(policy RevocationPolicy) *CertRevocationChecker {
+	c := new(CertRevocationChecker)
+	c.Policy = policy
+	c.UseOCSP = true
+	c.UseCRLDistributionPoints = true
+	c.crl = make(map[string]*crlEntry)
+	c.ocsp = make(map[string]*ocspResult)
+	return c
+}
+
+// 证书吊销检查，先查ocsp，再查crl，
+// 结果都缓存到nextUpdate，没有nextUpdate的缓存一个小时
+type CertRevocationChecker struct {
+	Policy                   RevocationPolicy
+	UseOCSP                  bool         // 查询证书的OCSPServer
+	UseCRLDistributionPoints bool         // 下载证书的CRLDistributionPoints
+	Client                   *http.Client // nil使用http.DefaultClient
+	lock                     sync.Mutex
+	local                    []*crlEntry            // 本地文件加载的crl
+	crl                      map[string]*crlEntry   // 下载的crl，url
+	ocsp                     map[string]*ocspResult // ocsp的结果，ocspCertID.key()
+}
+
+// crl和它的过期时间
+type crlEntry struct {
+	crl    *x509.RevocationList
+	expiry time.Time
+}
+
+// nextUpdate，没有的话是since之后defaultCRLCacheTTL，
+// 下载的crl的since是下载的时间，本地文件是thisUpdate
+func newCRLEntry(crl *x509.RevocationList, since time.Time) *crlEntry {
+	e := new(crlEntry)
+	e.crl = crl
+	e.expiry = crl.NextUpdate
+	if e.expiry.IsZero() {
+		e.expiry = since.Add(defaultCRLCacheTTL)
+	}
+	return e
+}
+
+// 加载本地的crl文件，der或者pem格式
+func (c *CertRevocationChecker) LoadCRLFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if b, _ := pem.Decode(data); b != nil {
+		data = b.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.local = append(c.local, newCRLEntry(crl, crl.ThisUpdate))
+	c.lock.Unlock()
+	return nil
+}
+
+// 检查证书链，chain[0]是叶子证书，最后是根证书，
+// 除根证书以外的每一个证书都使用它的颁发者检查
+func (c *CertRevocationChecker) Check(chain []*x509.Certificate, now time.Time) error {
+	for i := 0; i < len(chain)-1; i++ {
+		err := c.check(chain[i], chain[i+1], now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *CertRevocationChecker) check(cert, issuer *x509.Certificate, now time.Time) error {
+	// ocsp
+	if c.UseOCSP && len(cert.OCSPServer) > 0 {
+		r, err := c.queryOCSP(cert, issuer, now)
+		if err == nil {
+			switch r.status {
+			case ocspGood:
+				return nil
+			case ocspRevoked:
+				return ErrCertificateRevoked
+			}
+		}
+	}
+	// crl
+	revoked, found := c.checkCRL(cert, issuer, now)
+	if revoked {
+		return ErrCertificateRevoked
+	}
+	if found || c.Policy == SoftFail {
+		return nil
+	}
+	return ErrCertificateStatusUnknown
+}
+
+// 先查缓存
+func (c *CertRevocationChecker) queryOCSP(cert, issuer *x509.Certificate, now time.Time) (*ocspResult, error) {
+	id, err := newOCSPCertID(cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	key := id.key()
+	c.lock.Lock()
+	r, ok := c.ocsp[key]
+	c.lock.Unlock()
+	if ok && now.Before(r.nextUpdate) {
+		return r, nil
+	}
+	r, err = queryOCSP(c.Client, cert, issuer, now)
+	if err != nil {
+		return nil, err
+	}
+	if r.nextUpdate.IsZero() {
+		r.nextUpdate = now.Add(defaultOCSPCacheTTL)
+	}
+	c.lock.Lock()
+	c.ocsp[key] = r
+	c.lock.Unlock()
+	return r, nil
+}
+
+// 返回是否吊销，是否找到了有效的crl
+func (c *CertRevocationChecker) checkCRL(cert, issuer *x509.Certificate, now time.Time) (revoked, found bool) {
+	c.lock.Lock()
+	crls := make([]*crlEntry, len(c.local))
+	copy(crls, c.local)
+	c.lock.Unlock()
+	if c.UseCRLDistributionPoints {
+		for _, u := range cert.CRLDistributionPoints {
+			crl, err := c.fetchCRL(u, now)
+			if err == nil {
+				crls = append(crls, crl)
+			}
+		}
+	}
+	for _, crl := range crls {
+		if !validCRL(crl, issuer, now) {
+			continue
+		}
+		found = true
+		for _, e := range crl.crl.RevokedCertificateEntries {
+			if e.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return true, true
+			}
+		}
+	}
+	return false, found
+}
+
+// crl是issuer签名的，并且没有过期
+func validCRL(e *crlEntry, issuer *x509.Certificate, now time.Time) bool {
+	if e.crl.CheckSignatureFrom(issuer) != nil {
+		return false
+	}
+	if now.Before(e.crl.ThisUpdate) {
+		return false
+	}
+	return now.Before(e.expiry)
+}
+
+// 下载crl，缓存到过期时间
+func (c *CertRevocationChecker) fetchCRL(url string, now time.Time) (*crlEntry, error) {
+	c.lock.Lock()
+	e, ok := c.crl[url]
+	c.lock.Unlock()
+	if ok && now.Before(e.expiry) {
+		return e, nil
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crl <%s> status <%d>", url, res.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	if b, _ := pem.Decode(data); b != nil {
+		data = b.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, err
+	}
+	e = newCRLEntry(crl, now)
+	c.lock.Lock()
+	c.crl[url] = e
+	c.lock.Unlock()
+	return e, nil
+}
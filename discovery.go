@@ -0,0 +1,243 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DiscoveryPath = "/.well-known/openid-configuration" // 发现文档路径
+	JWKSPath      = "/.well-known/jwks.json"            // jwks路径
+)
+
+// oidc发现文档
+type DiscoveryDocument struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	TokenEndpoint                    string   `json:"token_endpoint,omitempty"`
+	ResponseTypesSupported           []string `json:"response_types_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+func NewDiscoveryHandler(issuer string, provider *DefaultProvider) *DiscoveryHandler {
+	h := new(DiscoveryHandler)
+	h.Issuer = issuer
+	h.Provider = provider
+	return h
+}
+
+// 提供DiscoveryPath和JWKSPath，挂载在issuer的根路径
+type DiscoveryHandler struct {
+	Issuer        string           // 签发者
+	TokenEndpoint string           // 可选
+	Provider      *DefaultProvider // 公钥和支持的算法
+}
+
+// 根据provider配置的密钥生成文档
+func (h *DiscoveryHandler) Document() *DiscoveryDocument {
+	d := new(DiscoveryDocument)
+	d.Issuer = h.Issuer
+	d.JWKSURI = strings.TrimSuffix(h.Issuer, "/") + JWKSPath
+	d.TokenEndpoint = h.TokenEndpoint
+	d.ResponseTypesSupported = []string{"code", "id_token", "code id_token"}
+	d.SubjectTypesSupported = []string{"public"}
+	d.IDTokenSigningAlgValuesSupported = make([]string, 0)
+	for _, a := range h.Provider.Algs() {
+		d.IDTokenSigningAlgValuesSupported = append(d.IDTokenSigningAlgValuesSupported, string(a))
+	}
+	return d
+}
+
+func (h *DiscoveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Path {
+	case DiscoveryPath:
+		writeJSON(w, http.StatusOK, h.Document())
+	case JWKSPath:
+		writeJSON(w, http.StatusOK, h.Provider.JWKS())
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// 读取json的最大字节
+const maxJSONBody = 1 << 20
+
+// client是nil时使用的client，不能没有超时
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// 读取url的json，client是nil使用defaultHTTPClient
+func getJSON(client *http.Client, url string, v interface{}) error {
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("get <%s> status <%d>", url, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, maxJSONBody)).Decode(v)
+}
+
+// config是nil使用DefaultConfig
+func NewRemoteJWKS(client *http.Client, url string, config *Config) *RemoteJWKS {
+	j := new(RemoteJWKS)
+	j.Client = client
+	j.URL = url
+	j.Config = config
+	j.MinRefreshInterval = time.Minute
+	return j
+}
+
+// 远程的jwks，找不到kid时重新获取，
+// 获取时不持有锁，同时只有一个请求，其他需要获取的调用者等待它的结果
+type RemoteJWKS struct {
+	Client             *http.Client  // nil使用有超时的默认client
+	URL                string        // jwks地址
+	Config             *Config       // 时间来源，nil使用DefaultConfig
+	MinRefreshInterval time.Duration // 两次获取的最小间隔
+	lock               sync.Mutex    // 同步锁
+	set                *JWKSet       // 缓存
+	fetchTime          time.Time     // 上一次获取的时间
+	fetch              *jwksFetch    // 正在进行的获取
+}
+
+// 一次获取，done关闭之后err可以读取
+type jwksFetch struct {
+	done chan struct{}
+	err  error
+}
+
+func (j *RemoteJWKS) config() *Config {
+	if j.Config == nil {
+		return DefaultConfig
+	}
+	return j.Config
+}
+
+// 重新获取
+func (j *RemoteJWKS) Refresh() error {
+	return j.refresh()
+}
+
+// 已经有获取在进行就等待它的结果
+func (j *RemoteJWKS) refresh() error {
+	j.lock.Lock()
+	f := j.fetch
+	if f != nil {
+		j.lock.Unlock()
+		<-f.done
+		return f.err
+	}
+	f = &jwksFetch{done: make(chan struct{})}
+	j.fetch = f
+	j.fetchTime = j.config().now()
+	j.lock.Unlock()
+	set := new(JWKSet)
+	f.err = getJSON(j.Client, j.URL, set)
+	j.lock.Lock()
+	if f.err == nil {
+		j.set = set
+	}
+	j.fetch = nil
+	j.lock.Unlock()
+	close(f.done)
+	return f.err
+}
+
+// 缓存中的key
+func (j *RemoteJWKS) find(kid, alg string) *JWK {
+	if j.set == nil {
+		return nil
+	}
+	return j.set.Find(kid, alg)
+}
+
+// 实现KeyFunc，返回header的kid或者alg对应的公钥
+func (j *RemoteJWKS) KeyFunc(header Claims) (interface{}, error) {
+	kid, _ := header["kid"].(string)
+	alg, _ := header["alg"].(string)
+	j.lock.Lock()
+	k := j.find(kid, alg)
+	refresh := k == nil && (j.fetch != nil || j.config().now().Sub(j.fetchTime) >= j.MinRefreshInterval)
+	j.lock.Unlock()
+	if refresh {
+		err := j.refresh()
+		if err != nil {
+			return nil, err
+		}
+		j.lock.Lock()
+		k = j.find(kid, alg)
+		j.lock.Unlock()
+	}
+	return jwkPublicKey(k, alg)
+}
+
+// 读取issuer的发现文档，使用其中的jwks验证token，
+// config用于验证和jwks的刷新间隔，nil使用DefaultConfig
+func Discover(client *http.Client, issuer string, config *Config) (*DiscoveryClient, error) {
+	d := new(DiscoveryDocument)
+	err := getJSON(client, strings.TrimSuffix(issuer, "/")+DiscoveryPath, d)
+	if err != nil {
+		return nil, err
+	}
+	if d.Issuer != issuer {
+		return nil, ErrInvalidIssuer
+	}
+	if d.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of <%s> has no jwks_uri", issuer)
+	}
+	c := new(DiscoveryClient)
+	c.Document = d
+	c.Config = config
+	c.JWKS = NewRemoteJWKS(client, d.JWKSURI, config)
+	err = c.JWKS.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// 发现文档的使用者
+type DiscoveryClient struct {
+	Document *DiscoveryDocument // 发现文档
+	JWKS     *RemoteJWKS        // 文档中的jwks
+	Config   *Config            // nil使用DefaultConfig
+}
+
+// 验证签名，算法必须是文档支持的，iss必须是文档的issuer
+func (c *DiscoveryClient) Verify(token string) (header, payload Claims, err error) {
+	header, payload, err = VerifyWithKeyFunc(token, func(header Claims) (interface{}, error) {
+		alg, _ := header["alg"].(string)
+		if !containsString(c.Document.IDTokenSigningAlgValuesSupported, alg) {
+			return nil, ErrUnsupportedAlg
+		}
+		return c.JWKS.KeyFunc(header)
+	}, c.Config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload["iss"] != c.Document.Issuer {
+		return nil, nil, ErrInvalidIssuer
+	}
+	return
+}
@@ -0,0 +1,230 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DPoPTyp = "dpop+jwt" // dpop proof的header.typ
+)
+
+var (
+	ErrInvalidDPoPProof = errors.New("invalid dpop proof")
+	ErrDPoPBinding      = errors.New("dpop key does not match access token")
+)
+
+// 创建rfc9449 dpop proof，key是客户端私钥，*rsa.PrivateKey或者*ecdsa.PrivateKey，
+// header.jwk是公钥，accessToken不为空设置ath
+func NewDPoPProof(alg Alg, key crypto.Signer, method, url, accessToken string, config *Config) (string, error) {
+	if config == nil {
+		config = DefaultConfig
+	}
+	jwk, err := NewJWK(key.Public(), "", "")
+	if err != nil {
+		return "", err
+	}
+	jwk.Use = ""
+	header := make(Claims)
+	header["typ"] = DPoPTyp
+	header["jwk"] = jwk
+	payload := make(Claims)
+	payload["htm"] = method
+	payload["htu"] = url
+	payload["iat"] = config.now().Unix()
+	if accessToken != "" {
+		payload["ath"] = accessTokenHash(accessToken)
+	}
+	return SignWithKey(alg, header, payload, key, config)
+}
+
+// base64(sha256(access token))
+func accessTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// header或者payload中的jwk对象
+func jwkOfClaim(v interface{}) (*JWK, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	// 不能是私钥
+	if _, ok = m["d"]; ok {
+		return nil, ErrUnsupportedKey
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	j := new(JWK)
+	err = json.Unmarshal(data, j)
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func NewDPoPVerifier(replay ConsumeStore) *DPoPVerifier {
+	v := new(DPoPVerifier)
+	v.Replay = replay
+	v.MaxAge = 5 * time.Minute
+	return v
+}
+
+// rfc9449 dpop proof验证
+type DPoPVerifier struct {
+	MaxAge time.Duration // proof的iat和当前时间允许的差距
+	Replay ConsumeStore  // 不为nil，proof的jti只能使用一次
+	Config *Config       // nil使用DefaultConfig
+}
+
+// 验证proof，使用header.jwk验证签名，检查htm，htu，iat，jti和ath，
+// accessToken为空不检查ath，返回jwk的sha256指纹
+func (v *DPoPVerifier) Verify(proof, method, url, accessToken string) (string, error) {
+	config := v.Config
+	if config == nil {
+		config = DefaultConfig
+	}
+	var jwk *JWK
+	header, payload, err := VerifyWithKeyFunc(proof, func(header Claims) (interface{}, error) {
+		alg, _ := header["alg"].(string)
+		if strings.HasPrefix(strings.ToUpper(alg), "HS") {
+			return nil, ErrUnsupportedAlg
+		}
+		var err error
+		jwk, err = jwkOfClaim(header["jwk"])
+		if err != nil {
+			return nil, err
+		}
+		return jwk.PublicKey()
+	}, config)
+	if err != nil {
+		return "", err
+	}
+	if header["typ"] != DPoPTyp {
+		return "", ErrInvalidDPoPProof
+	}
+	// htm和htu
+	if payload["htm"] != method {
+		return "", ErrInvalidDPoPProof
+	}
+	htu, _ := payload["htu"].(string)
+	if normalizeHTU(htu) != normalizeHTU(url) {
+		return "", ErrInvalidDPoPProof
+	}
+	// iat
+	iat, ok := claimInt64(payload, "iat")
+	if !ok {
+		return "", ErrInvalidDPoPProof
+	}
+	d := config.now().Sub(time.Unix(iat, 0))
+	if d > v.MaxAge+config.Leeway || d < -v.MaxAge-config.Leeway {
+		return "", ErrInvalidDPoPProof
+	}
+	// ath
+	if accessToken != "" && payload["ath"] != accessTokenHash(accessToken) {
+		return "", ErrInvalidDPoPProof
+	}
+	// jti
+	jti, _ := payload["jti"].(string)
+	if jti == "" {
+		return "", ErrInvalidDPoPProof
+	}
+	if v.Replay != nil {
+		ok, err = v.Replay.Consume("dpop "+jti, time.Unix(iat, 0).Add(v.MaxAge+config.Leeway))
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", ErrInvalidDPoPProof
+		}
+	}
+	return jwk.Thumbprint(crypto.SHA256)
+}
+
+// 去掉query和fragment，scheme和host小写
+func normalizeHTU(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// 请求的完整url
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.EscapedPath()
+}
+
+// 验证access token的函数，返回payload
+type TokenVerifier func(token string) (Claims, error)
+
+// 验证请求，Authorization是"DPoP token"，DPoP是proof，
+// access token的cnf.jkt必须和proof的jwk指纹相同
+func (v *DPoPVerifier) VerifyRequest(r *http.Request, verify TokenVerifier) (Claims, error) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < 5 || !strings.EqualFold(auth[:5], "DPoP ") {
+		return nil, ErrInvalidToken
+	}
+	token := strings.TrimSpace(auth[5:])
+	payload, err := verify(token)
+	if err != nil {
+		return nil, err
+	}
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) != 1 {
+		return nil, ErrInvalidDPoPProof
+	}
+	jkt, err := v.Verify(proofs[0], r.Method, requestURL(r), token)
+	if err != nil {
+		return nil, err
+	}
+	cnf, _ := payload["cnf"].(map[string]interface{})
+	if cnf == nil || cnf["jkt"] != jkt {
+		return nil, ErrDPoPBinding
+	}
+	return payload, nil
+}
+
+type claimsContextKey struct{}
+
+// 中间件保存在context中的access token payload
+func ClaimsFromContext(ctx context.Context) Claims {
+	c, _ := ctx.Value(claimsContextKey{}).(Claims)
+	return c
+}
+
+// dpop中间件，验证失败返回401，成功之后payload保存在context中
+func (v *DPoPVerifier) Middleware(verify TokenVerifier, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := v.VerifyRequest(r, verify)
+		if err != nil {
+			code := "invalid_token"
+			if err == ErrInvalidDPoPProof {
+				code = "invalid_dpop_proof"
+			}
+			w.Header().Set("WWW-Authenticate", `DPoP error="`+code+`"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsContextKey{}, payload)))
+	})
+}
@@ -0,0 +1,328 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HookEvent.Op
+const (
+	HookSign   = "sign"
+	HookVerify = "verify"
+)
+
+// HookEvent.Outcome
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// HookEvent.Error，失败的分类
+const (
+	ErrorClassMalformed   = "malformed"     // 不能解析
+	ErrorClassInvalid     = "invalid"       // 格式或者签名错误
+	ErrorClassAlg         = "alg"           // 不支持的算法
+	ErrorClassKey         = "key"           // 没有key，key不能使用，过期或者吊销
+	ErrorClassExpired     = "expired"       // exp
+	ErrorClassNotValidYet = "not_yet_valid" // nbf
+	ErrorClassRevoked     = "revoked"       // jti已经吊销
+	ErrorClassOther       = "other"
+)
+
+// kid和alg可能来自没有验证的token，限制长度
+const maxHookString = 128
+
+// 签名和验证的事件，不包含token，key和claims
+type HookEvent struct {
+	Time     time.Time // config的时间
+	Op       string    // HookSign或者HookVerify
+	Alg      Alg
+	Kid      string
+	Issuer   string // 签名的payload.iss，验证成功的payload.iss
+	Outcome  string
+	Error    string // 失败的分类，成功是空
+	Duration time.Duration
+}
+
+// Config.Hooks，每次签名和验证之后调用，需要自己处理并发
+type Hooks interface {
+	OnSign(e *HookEvent)
+	OnVerify(e *HookEvent)
+}
+
+// 依次调用多个Hooks
+func NewMultiHooks(hooks ...Hooks) Hooks {
+	return multiHooks(hooks)
+}
+
+type multiHooks []Hooks
+
+func (m multiHooks) OnSign(e *HookEvent) {
+	for _, h := range m {
+		h.OnSign(e)
+	}
+}
+
+func (m multiHooks) OnVerify(e *HookEvent) {
+	for _, h := range m {
+		h.OnVerify(e)
+	}
+}
+
+func newHookEvent(c *Config, op string, alg Alg, header, payload Claims, start time.Time, err error) *HookEvent {
+	e := new(HookEvent)
+	e.Time = c.now()
+	e.Op = op
+	e.Alg = Alg(limitHookString(string(alg)))
+	if s, ok := header["kid"].(string); ok {
+		e.Kid = limitHookString(s)
+	}
+	if s, ok := payload["iss"].(string); ok {
+		e.Issuer = limitHookString(s)
+	}
+	e.Outcome = OutcomeSuccess
+	if err != nil {
+		e.Outcome = OutcomeFailure
+		e.Error = errorClass(err)
+	}
+	e.Duration = time.Since(start)
+	return e
+}
+
+// 调用config的Hooks，返回err
+func observeSign(c *Config, alg Alg, header, payload Claims, start time.Time, err error) error {
+	if c.Hooks != nil {
+		c.Hooks.OnSign(newHookEvent(c, HookSign, alg, header, payload, start, err))
+	}
+	return err
+}
+
+// 验证失败时header是nil，从token中得到alg和kid
+func observeVerify(c *Config, token string, header, payload Claims, start time.Time, err error) {
+	if c.Hooks == nil {
+		return
+	}
+	if header == nil {
+		header = make(Claims)
+		if i := strings.IndexByte(token, '.'); i > 0 {
+			b, e := base64.RawURLEncoding.DecodeString(token[:i])
+			if e == nil {
+				_ = json.Unmarshal(b, &header)
+			}
+		}
+	}
+	alg, _ := header["alg"].(string)
+	c.Hooks.OnVerify(newHookEvent(c, HookVerify, Alg(alg), header, payload, start, err))
+}
+
+func limitHookString(s string) string {
+	if len(s) > maxHookString {
+		return s[:maxHookString]
+	}
+	return s
+}
+
+// 错误的分类，不使用错误信息，里面可能有token的内容
+func errorClass(err error) string {
+	switch err {
+	case ErrTokenExpired:
+		return ErrorClassExpired
+	case ErrTokenNotValidYet:
+		return ErrorClassNotValidYet
+	case ErrTokenRevoked:
+		return ErrorClassRevoked
+	case ErrInvalidToken:
+		return ErrorClassInvalid
+	case ErrUnsupportedAlg:
+		return ErrorClassAlg
+	case ErrKeyNotFound, ErrUnsupportedKey, ErrKeyUsage, ErrKeyExpired, ErrKeyRetired, ErrKeyRevoked, ErrKeyLifetime:
+		return ErrorClassKey
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var b64Err base64.CorruptInputError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.As(err, &b64Err) {
+		return ErrorClassMalformed
+	}
+	if strings.HasPrefix(err.Error(), "unsupported algorithm") {
+		return ErrorClassAlg
+	}
+	return ErrorClassOther
+}
+
+// 延迟直方图的上限
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+// 实现expvar.Var，buckets是累计的次数，key是上限的秒数
+type latencyHistogram struct {
+	lock   sync.Mutex
+	counts []uint64 // 最后一个是+Inf
+	sum    time.Duration
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	h := new(latencyHistogram)
+	h.counts = make([]uint64, len(latencyBuckets)+1)
+	return h
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	h.lock.Lock()
+	h.counts[i]++
+	h.sum += d
+	h.lock.Unlock()
+}
+
+func (h *latencyHistogram) String() string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	var str strings.Builder
+	str.WriteString(`{"buckets":{`)
+	var n uint64
+	for i, c := range h.counts {
+		n += c
+		if i > 0 {
+			str.WriteByte(',')
+		}
+		if i < len(latencyBuckets) {
+			str.WriteString(strconv.Quote(strconv.FormatFloat(latencyBuckets[i].Seconds(), 'g', -1, 64)))
+		} else {
+			str.WriteString(`"+Inf"`)
+		}
+		str.WriteByte(':')
+		str.WriteString(strconv.FormatUint(n, 10))
+	}
+	str.WriteString(`},"count":`)
+	str.WriteString(strconv.FormatUint(n, 10))
+	str.WriteString(`,"sum":`)
+	str.WriteString(strconv.FormatFloat(h.sum.Seconds(), 'g', -1, 64))
+	str.WriteByte('}')
+	return str.String()
+}
+
+// 在expvar的name下发布计数和延迟，
+// 计数是"op.alg.outcome"和"op.alg.failure.error"，延迟是"op.alg.latency"，
+// name已经发布会panic
+func NewExpvarHooks(name string) *ExpvarHooks {
+	h := new(ExpvarHooks)
+	h.vars = expvar.NewMap(name)
+	h.latency = make(map[string]*latencyHistogram)
+	return h
+}
+
+// 发布到expvar的Hooks
+type ExpvarHooks struct {
+	vars    *expvar.Map
+	lock    sync.Mutex
+	latency map[string]*latencyHistogram
+}
+
+func (h *ExpvarHooks) OnSign(e *HookEvent) {
+	h.add(e)
+}
+
+func (h *ExpvarHooks) OnVerify(e *HookEvent) {
+	h.add(e)
+}
+
+func (h *ExpvarHooks) add(e *HookEvent) {
+	// 没有验证的alg可以是任意值，不能作为变量名，
+	// Verify不区分大小写，统一成大写，hs256和HS256是同一个变量
+	alg := strings.ToUpper(string(e.Alg))
+	if e.Alg.Hash() == 0 {
+		alg = "unknown"
+	}
+	name := e.Op + "." + alg
+	h.vars.Add(name+"."+e.Outcome, 1)
+	if e.Error != "" {
+		h.vars.Add(name+"."+e.Outcome+"."+e.Error, 1)
+	}
+	name += ".latency"
+	h.lock.Lock()
+	l, ok := h.latency[name]
+	if !ok {
+		l = newLatencyHistogram()
+		h.latency[name] = l
+		h.vars.Set(name, l)
+	}
+	h.lock.Unlock()
+	l.observe(e.Duration)
+}
+
+// 每个事件写一行json
+func NewAuditLogHooks(w io.Writer) *AuditLogHooks {
+	h := new(AuditLogHooks)
+	h.w = w
+	return h
+}
+
+// 写审计日志的Hooks
+type AuditLogHooks struct {
+	// 不为nil，只记录返回true的事件，比如只记录失败
+	Filter func(e *HookEvent) bool
+	lock   sync.Mutex
+	w      io.Writer
+}
+
+// 日志的一行
+type auditLogLine struct {
+	Time     string  `json:"time"`
+	Op       string  `json:"op"`
+	Alg      Alg     `json:"alg"`
+	Kid      string  `json:"kid,omitempty"`
+	Issuer   string  `json:"iss,omitempty"`
+	Outcome  string  `json:"outcome"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_ms"`
+}
+
+func (h *AuditLogHooks) OnSign(e *HookEvent) {
+	h.write(e)
+}
+
+func (h *AuditLogHooks) OnVerify(e *HookEvent) {
+	h.write(e)
+}
+
+func (h *AuditLogHooks) write(e *HookEvent) {
+	if h.Filter != nil && !h.Filter(e) {
+		return
+	}
+	l := new(auditLogLine)
+	l.Time = e.Time.UTC().Format(time.RFC3339Nano)
+	l.Op = e.Op
+	l.Alg = e.Alg
+	l.Kid = e.Kid
+	l.Issuer = e.Issuer
+	l.Outcome = e.Outcome
+	l.Error = e.Error
+	l.Duration = float64(e.Duration) / float64(time.Millisecond)
+	data, err := json.Marshal(l)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+	h.lock.Lock()
+	_, _ = h.w.Write(data)
+	h.lock.Unlock()
+}
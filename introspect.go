@@ -0,0 +1,113 @@
+package jwt
+
+import (
+	"net/http"
+)
+
+func NewIntrospectionHandler(clients *ClientRegistry, provider Provider) *IntrospectionHandler {
+	h := new(IntrospectionHandler)
+	h.Clients = clients
+	h.Provider = provider
+	return h
+}
+
+// rfc7662 token introspection
+type IntrospectionHandler struct {
+	Clients  *ClientRegistry // 调用者必须是认证的客户端
+	Provider Provider        // 验证token，包括exp，nbf和吊销列表
+}
+
+func (h *IntrospectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeOAuthError(w, http.StatusMethodNotAllowed, "invalid_request", "method must be POST")
+		return
+	}
+	_, err := h.Clients.Authenticate(r)
+	if err != nil {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "missing token")
+		return
+	}
+	res := make(map[string]interface{})
+	_, payload, err := Verify(token, h.Provider)
+	if err != nil {
+		// 不告诉调用者原因
+		res["active"] = false
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	for k, v := range payload {
+		res[k] = v
+	}
+	res["active"] = true
+	res["token_type"] = "Bearer"
+	writeJSON(w, http.StatusOK, res)
+}
+
+// store是nil，使用provider配置的吊销列表
+func NewRevocationHandler(clients *ClientRegistry, provider Provider, store RevocationStore) *RevocationHandler {
+	h := new(RevocationHandler)
+	h.Clients = clients
+	h.Provider = provider
+	h.Store = store
+	if h.Store == nil {
+		h.Store = configOf(provider).Revocation
+	}
+	return h
+}
+
+// rfc7009 token revocation，记录jti，
+// Store和provider配置的吊销列表是同一个时，之后的验证和introspection都会失败
+type RevocationHandler struct {
+	Clients  *ClientRegistry // 调用者必须是认证的客户端
+	Provider Provider        // 验证token的签名
+	Store    RevocationStore // 吊销列表
+}
+
+func (h *RevocationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeOAuthError(w, http.StatusMethodNotAllowed, "invalid_request", "method must be POST")
+		return
+	}
+	c, err := h.Clients.Authenticate(r)
+	if err != nil {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "missing token")
+		return
+	}
+	if h.Store == nil {
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+	_, payload, err := Verify(token, h.Provider)
+	if err != nil {
+		// 无效的token也返回成功
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// 只能吊销自己的token，没有client_id的token不能确定是谁的
+	if id, _ := payload["client_id"].(string); id == "" || id != c.ID {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "")
+		return
+	}
+	err = RevokePayload(h.Store, payload, configOf(h.Provider))
+	if err != nil {
+		if err == ErrInvalidToken {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token has no jti")
+			return
+		}
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
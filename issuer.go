@@ -0,0 +1,130 @@
+package jwt
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrUnknownIssuer = errors.New("unknown issuer")
+)
+
+// 信任的签发者，每个签发者有自己的key和规则
+type TrustedIssuer struct {
+	Issuer    string   // payload.iss，空表示没有iss的token
+	KeyIDs    []string // 不为空，header.kid必须是其中之一，同一个iss有多个配置时用来选择
+	Algs      []Alg    // 允许的算法，空表示任意
+	Audiences []string // 不为空，aud必须包含其中之一
+	KeyFunc   KeyFunc  // key的来源，比如JWKSet，RemoteJWKS，OctetKeySet的KeyFunc
+	Provider  Provider // KeyFunc是nil使用它验证
+	Config    *Config  // KeyFunc使用的配置，nil使用DefaultConfig
+}
+
+// 检查token的kid
+func (t *TrustedIssuer) matchKeyID(kid string) bool {
+	return len(t.KeyIDs) < 1 || containsString(t.KeyIDs, kid)
+}
+
+// 验证签名和规则
+func (t *TrustedIssuer) verify(token string, header Claims) (Claims, Claims, error) {
+	if len(t.Algs) > 0 {
+		alg, _ := header["alg"].(string)
+		ok := false
+		for _, a := range t.Algs {
+			if string(a) == alg {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, nil, ErrUnsupportedAlg
+		}
+	}
+	var payload Claims
+	var err error
+	if t.KeyFunc != nil {
+		header, payload, err = VerifyWithKeyFunc(token, t.KeyFunc, t.Config)
+	} else if t.Provider != nil {
+		header, payload, err = Verify(token, t.Provider)
+	} else {
+		err = ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(t.Audiences) > 0 {
+		aud := claimStrings(payload, "aud")
+		ok := false
+		for _, a := range t.Audiences {
+			if containsString(aud, a) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, nil, ErrInvalidAudience
+		}
+	}
+	return header, payload, nil
+}
+
+func NewMultiIssuerVerifier(issuers ...*TrustedIssuer) *MultiIssuerVerifier {
+	v := new(MultiIssuerVerifier)
+	v.issuers = issuers
+	return v
+}
+
+// 多个签发者的验证，根据没有验证的iss和kid选择签发者
+type MultiIssuerVerifier struct {
+	lock    sync.RWMutex
+	issuers []*TrustedIssuer
+}
+
+func (v *MultiIssuerVerifier) Add(issuer *TrustedIssuer) {
+	v.lock.Lock()
+	v.issuers = append(v.issuers, issuer)
+	v.lock.Unlock()
+}
+
+// 删除iss的所有配置
+func (v *MultiIssuerVerifier) Remove(iss string) {
+	v.lock.Lock()
+	issuers := make([]*TrustedIssuer, 0, len(v.issuers))
+	for _, t := range v.issuers {
+		if t.Issuer != iss {
+			issuers = append(issuers, t)
+		}
+	}
+	v.issuers = issuers
+	v.lock.Unlock()
+}
+
+// 返回iss和kid对应的签发者，没有返回nil
+func (v *MultiIssuerVerifier) Find(iss, kid string) *TrustedIssuer {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	for _, t := range v.issuers {
+		if t.Issuer == iss && t.matchKeyID(kid) {
+			return t
+		}
+	}
+	return nil
+}
+
+// 找到签发者，然后使用它的key和规则验证，签发者不在列表中返回ErrUnknownIssuer
+func (v *MultiIssuerVerifier) Verify(token string) (header, payload Claims, err error) {
+	header, payload, _, err = parseUnverified(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	iss, ok := payload["iss"].(string)
+	if !ok && payload["iss"] != nil {
+		return nil, nil, ErrInvalidIssuer
+	}
+	kid, _ := header["kid"].(string)
+	t := v.Find(iss, kid)
+	if t == nil {
+		return nil, nil, ErrUnknownIssuer
+	}
+	return t.verify(token, header)
+}
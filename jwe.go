@@ -0,0 +1,401 @@
+package jwt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// rfc7516 jwe，只支持compact格式
+
+// 密钥管理算法
+const (
+	RSAOAEPAlg    Alg = "RSA-OAEP"
+	RSAOAEP256Alg Alg = "RSA-OAEP-256"
+	A128GCMKWAlg  Alg = "A128GCMKW"
+	A192GCMKWAlg  Alg = "A192GCMKW"
+	A256GCMKWAlg  Alg = "A256GCMKW"
+	DirAlg        Alg = "dir"
+)
+
+// 内容加密算法
+type Enc string
+
+const (
+	A128GCMEnc      Enc = "A128GCM"
+	A192GCMEnc      Enc = "A192GCM"
+	A256GCMEnc      Enc = "A256GCM"
+	A128CBCHS256Enc Enc = "A128CBC-HS256"
+	A192CBCHS384Enc Enc = "A192CBC-HS384"
+	A256CBCHS512Enc Enc = "A256CBC-HS512"
+)
+
+var (
+	ErrDecryption = errors.New("decryption failed")
+)
+
+// cek的字节数，不支持返回0
+func (e Enc) KeySize() int {
+	switch e {
+	case A128GCMEnc:
+		return 16
+	case A192GCMEnc:
+		return 24
+	case A256GCMEnc, A128CBCHS256Enc:
+		return 32
+	case A192CBCHS384Enc:
+		return 48
+	case A256CBCHS512Enc:
+		return 64
+	default:
+		return 0
+	}
+}
+
+// jwe的接收者
+type Recipient struct {
+	Alg   Alg         // 密钥管理算法
+	Enc   Enc         // 内容加密算法
+	Key   interface{} // 接收者的key，rsa算法是*rsa.PublicKey或者*JWK，pbes2算法是口令，gcmkw和dir是[]byte
+	KeyID string      // 不为空设置header.kid
+	P2C   int         // pbes2的迭代次数，0使用PBES2DefaultCount
+	P2S   []byte      // pbes2的salt，nil使用16字节随机数
+}
+
+// 加密plaintext，返回compact格式的jwe，header可以是nil，
+// config是nil使用DefaultConfig
+func Encrypt(plaintext []byte, header Claims, recipient *Recipient, config *Config) (string, error) {
+	if config == nil {
+		config = DefaultConfig
+	}
+	size := recipient.Enc.KeySize()
+	if size < 1 {
+		return "", fmt.Errorf("unsupported encryption <%s>", recipient.Enc)
+	}
+	h := make(Claims)
+	for k, v := range header {
+		h[k] = v
+	}
+	h["alg"] = recipient.Alg
+	h["enc"] = recipient.Enc
+	if recipient.KeyID != "" {
+		h["kid"] = recipient.KeyID
+	}
+	cek, encryptedKey, err := wrapKey(recipient, h, size, config)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(data)
+	iv, ciphertext, tag, err := encryptContent(recipient.Enc, cek, plaintext, []byte(protected), config.random())
+	if err != nil {
+		return "", err
+	}
+	var str strings.Builder
+	str.WriteString(protected)
+	for _, b := range [][]byte{encryptedKey, iv, ciphertext, tag} {
+		str.WriteByte('.')
+		str.WriteString(base64.RawURLEncoding.EncodeToString(b))
+	}
+	return str.String(), nil
+}
+
+// 解密compact格式的jwe，keyFunc根据header返回解密的key
+func Decrypt(token string, keyFunc KeyFunc, config *Config) (header Claims, plaintext []byte, err error) {
+	if config == nil {
+		config = DefaultConfig
+	}
+	part := strings.Split(token, ".")
+	if len(part) != 5 {
+		return nil, nil, ErrInvalidToken
+	}
+	header, err = decodeClaims(part[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	// 不支持压缩
+	if _, ok := header["zip"]; ok {
+		return nil, nil, ErrInvalidToken
+	}
+	alg, _ := header["alg"].(string)
+	enc, _ := header["enc"].(string)
+	size := Enc(enc).KeySize()
+	if size < 1 {
+		return nil, nil, fmt.Errorf("unsupported encryption <%s>", enc)
+	}
+	var b [4][]byte
+	for i := range b {
+		b[i], err = base64.RawURLEncoding.DecodeString(part[i+1])
+		if err != nil {
+			return nil, nil, ErrInvalidToken
+		}
+	}
+	key, err := keyFunc(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	cek, err := unwrapKey(Alg(alg), header, b[0], key, size, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err = decryptContent(Enc(enc), cek, b[1], b[2], b[3], []byte(part[0]))
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, plaintext, nil
+}
+
+// 生成cek，返回cek和加密后的cek，需要的参数写到header
+func wrapKey(r *Recipient, header Claims, size int, config *Config) (cek, encryptedKey []byte, err error) {
+	alg, key := r.Alg, r.Key
+	if j, ok := key.(*JWK); ok {
+		key, err = j.PublicKey()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	switch alg {
+	case RSAOAEPAlg, RSAOAEP256Alg:
+		var k *rsa.PublicKey
+		switch v := key.(type) {
+		case *rsa.PublicKey:
+			k = v
+		case *rsa.PrivateKey:
+			k = &v.PublicKey
+		default:
+			return nil, nil, ErrUnsupportedKey
+		}
+		cek, err = randomBytes(config.random(), size)
+		if err != nil {
+			return nil, nil, err
+		}
+		encryptedKey, err = rsa.EncryptOAEP(oaepHash(alg), config.random(), k, cek, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cek, encryptedKey, nil
+	case PBES2HS256A128KWAlg, PBES2HS384A192KWAlg, PBES2HS512A256KWAlg:
+		return pbes2Wrap(r, header, size, config)
+	case A128GCMKWAlg, A192GCMKWAlg, A256GCMKWAlg:
+		k, ok := key.([]byte)
+		if !ok || len(k) != gcmKWKeySize(alg) {
+			return nil, nil, ErrUnsupportedKey
+		}
+		cek, err = randomBytes(config.random(), size)
+		if err != nil {
+			return nil, nil, err
+		}
+		// 使用gcm加密cek，这里的enc只用来选择gcm
+		iv, encryptedKey, tag, err := encryptContent(A128GCMEnc, k, cek, nil, config.random())
+		if err != nil {
+			return nil, nil, err
+		}
+		header["iv"] = base64.RawURLEncoding.EncodeToString(iv)
+		header["tag"] = base64.RawURLEncoding.EncodeToString(tag)
+		return cek, encryptedKey, nil
+	case DirAlg:
+		k, ok := key.([]byte)
+		if !ok || len(k) != size {
+			return nil, nil, ErrUnsupportedKey
+		}
+		return k, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+}
+
+// 解密cek
+func unwrapKey(alg Alg, header Claims, encryptedKey []byte, key interface{}, size int, config *Config) ([]byte, error) {
+	switch alg {
+	case RSAOAEPAlg, RSAOAEP256Alg:
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrUnsupportedKey
+		}
+		cek, err := rsa.DecryptOAEP(oaepHash(alg), nil, k, encryptedKey, nil)
+		if err != nil || len(cek) != size {
+			// rfc7516 11.5，使用随机的cek，让错误在解密内容时才出现
+			return randomBytes(config.random(), size)
+		}
+		return cek, nil
+	case PBES2HS256A128KWAlg, PBES2HS384A192KWAlg, PBES2HS512A256KWAlg:
+		return pbes2Unwrap(alg, header, encryptedKey, key, size)
+	case A128GCMKWAlg, A192GCMKWAlg, A256GCMKWAlg:
+		k, ok := key.([]byte)
+		if !ok || len(k) != gcmKWKeySize(alg) {
+			return nil, ErrUnsupportedKey
+		}
+		s1, _ := header["iv"].(string)
+		s2, _ := header["tag"].(string)
+		iv, err1 := base64.RawURLEncoding.DecodeString(s1)
+		tag, err2 := base64.RawURLEncoding.DecodeString(s2)
+		if err1 != nil || err2 != nil {
+			return nil, ErrInvalidToken
+		}
+		cek, err := decryptContent(A128GCMEnc, k, iv, encryptedKey, tag, nil)
+		if err != nil || len(cek) != size {
+			return nil, ErrDecryption
+		}
+		return cek, nil
+	case DirAlg:
+		k, ok := key.([]byte)
+		if !ok {
+			return nil, ErrUnsupportedKey
+		}
+		if len(encryptedKey) != 0 || len(k) != size {
+			return nil, ErrDecryption
+		}
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+}
+
+// gcmkw算法kek的字节数
+func gcmKWKeySize(alg Alg) int {
+	switch alg {
+	case A128GCMKWAlg:
+		return 16
+	case A192GCMKWAlg:
+		return 24
+	default:
+		return 32
+	}
+}
+
+func oaepHash(alg Alg) hash.Hash {
+	if alg == RSAOAEPAlg {
+		return sha1.New()
+	}
+	return sha256.New()
+}
+
+func randomBytes(random io.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(random, b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// 加密内容，aad是base64的header
+func encryptContent(enc Enc, cek, plaintext, aad []byte, random io.Reader) (iv, ciphertext, tag []byte, err error) {
+	if strings.HasSuffix(string(enc), "GCM") {
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		iv, err = randomBytes(random, gcm.NonceSize())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		b := gcm.Seal(nil, iv, plaintext, aad)
+		n := len(b) - gcm.Overhead()
+		return iv, b[:n], b[n:], nil
+	}
+	// rfc7518 5.2，cbc-hmac
+	n := len(cek) / 2
+	block, err := aes.NewCipher(cek[n:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iv, err = randomBytes(random, aes.BlockSize)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	ciphertext = make([]byte, len(plaintext)+pad)
+	copy(ciphertext, plaintext)
+	for i := len(plaintext); i < len(ciphertext); i++ {
+		ciphertext[i] = byte(pad)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+	tag = cbcTag(enc, cek[:n], aad, iv, ciphertext)
+	return iv, ciphertext, tag, nil
+}
+
+// 解密内容，所有失败都返回ErrDecryption
+func decryptContent(enc Enc, cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	if strings.HasSuffix(string(enc), "GCM") {
+		block, err := aes.NewCipher(cek)
+		if err != nil {
+			return nil, ErrDecryption
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil || len(iv) != gcm.NonceSize() || len(tag) != gcm.Overhead() {
+			return nil, ErrDecryption
+		}
+		b := make([]byte, 0, len(ciphertext)+len(tag))
+		b = append(b, ciphertext...)
+		b = append(b, tag...)
+		plaintext, err := gcm.Open(nil, iv, b, aad)
+		if err != nil {
+			return nil, ErrDecryption
+		}
+		return plaintext, nil
+	}
+	n := len(cek) / 2
+	if len(iv) != aes.BlockSize || len(ciphertext) < aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrDecryption
+	}
+	// 先验证tag
+	if subtle.ConstantTimeCompare(cbcTag(enc, cek[:n], aad, iv, ciphertext), tag) != 1 {
+		return nil, ErrDecryption
+	}
+	block, err := aes.NewCipher(cek[n:])
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	pad := int(plaintext[len(plaintext)-1])
+	if pad < 1 || pad > aes.BlockSize {
+		return nil, ErrDecryption
+	}
+	for _, b := range plaintext[len(plaintext)-pad:] {
+		if int(b) != pad {
+			return nil, ErrDecryption
+		}
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
+
+// hmac(aad || iv || ciphertext || al)的前一半
+func cbcTag(enc Enc, key, aad, iv, ciphertext []byte) []byte {
+	newHash := sha256.New
+	switch enc {
+	case A192CBCHS384Enc:
+		newHash = sha512.New384
+	case A256CBCHS512Enc:
+		newHash = sha512.New
+	}
+	m := hmac.New(newHash, key)
+	m.Write(aad)
+	m.Write(iv)
+	m.Write(ciphertext)
+	var al [8]byte
+	binary.BigEndian.PutUint64(al[:], uint64(len(aad))*8)
+	m.Write(al[:])
+	return m.Sum(nil)[:len(key)]
+}
@@ -0,0 +1,257 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// 测试jwe的加密和解密
+func Test_JWE(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	keyFunc := func(header Claims) (interface{}, error) {
+		return key, nil
+	}
+	plaintext := []byte("plaintext")
+	for _, alg := range []Alg{RSAOAEPAlg, RSAOAEP256Alg} {
+		for _, enc := range []Enc{A128GCMEnc, A192GCMEnc, A256GCMEnc, A128CBCHS256Enc, A192CBCHS384Enc, A256CBCHS512Enc} {
+			token, err := Encrypt(plaintext, nil, &Recipient{Alg: alg, Enc: enc, Key: &key.PublicKey}, nil)
+			if err != nil {
+				t.Fatal(alg, enc, err)
+			}
+			header, b, err := Decrypt(token, keyFunc, nil)
+			if err != nil {
+				t.Fatal(alg, enc, err)
+			}
+			if string(b) != string(plaintext) || header["enc"] != string(enc) {
+				t.Fatal(alg, enc, string(b))
+			}
+			// 修改密文
+			part := strings.Split(token, ".")
+			c := []byte(part[3])
+			if c[0] == 'A' {
+				c[0] = 'B'
+			} else {
+				c[0] = 'A'
+			}
+			part[3] = string(c)
+			_, _, err = Decrypt(strings.Join(part, "."), keyFunc, nil)
+			if err != ErrDecryption {
+				t.Fatal(alg, enc, err)
+			}
+		}
+	}
+}
+
+// 测试嵌套jwt
+func Test_NestedJWT(t *testing.T) {
+	issuer := NewDefaultProvider("hs256", "hs384", "hs512")
+	recipient := NewDefaultProvider("hs256", "hs384", "hs512")
+	recipient.GenEncryptionKey()
+	payload := NewPayload()
+	payload.SetSUB("sub")
+	token, err := SignAndEncrypt(ES256Alg, make(Claims), Claims(payload), issuer, recipient.Recipient(A256GCMEnc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(token, ".") != 4 {
+		t.Fatal(token)
+	}
+	_, claims, err := DecryptAndVerify(token, recipient, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["sub"] != "sub" {
+		t.Fatal(claims)
+	}
+	// 签名的key不能解密
+	_, _, err = DecryptAndVerify(token, issuer, issuer)
+	if err != ErrKeyNotFound {
+		t.Fatal(err)
+	}
+	// 别的签名者
+	_, _, err = DecryptAndVerify(token, recipient, recipient)
+	if err != ErrInvalidToken {
+		t.Fatal(err)
+	}
+	// 加密公钥在jwks中
+	set := recipient.JWKS()
+	j := set.Keys[len(set.Keys)-1]
+	if j.Use != "enc" || j.Alg != string(RSAOAEP256Alg) {
+		t.Fatal(j)
+	}
+	token, _ = SignAndEncrypt(HS256Alg, make(Claims), Claims(payload), issuer, &Recipient{Alg: RSAOAEPAlg, Enc: A128CBCHS256Enc, Key: j, KeyID: j.Kid})
+	_, _, err = DecryptAndVerifyWithKeyFunc(token, recipient.DecryptionKey, func(header Claims) (interface{}, error) {
+		return []byte("hs256"), nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 测试pbkdf2和aes key wrap
+func Test_PBES2(t *testing.T) {
+	// rfc7914 11
+	key := pbkdf2(sha256.New, []byte("passwd"), []byte("salt"), 1, 64)
+	if hex.EncodeToString(key) != "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783" {
+		t.Fatal(hex.EncodeToString(key))
+	}
+	// rfc3394 4.1
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F")
+	cek, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+	b, _ := aesKeyWrap(kek, cek)
+	if hex.EncodeToString(b) != "1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5" {
+		t.Fatal(hex.EncodeToString(b))
+	}
+	b, err := aesKeyUnwrap(kek, b)
+	if err != nil || !bytes.Equal(b, cek) {
+		t.Fatal(err)
+	}
+	// 导出和导入provider的key
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	pro.GenEncryptionKey()
+	token, err := pro.ExportKeys("password", PBES2MinCount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewDefaultProvider("", "", "")
+	err = other.ImportKeys(token, "wrong")
+	if err != ErrDecryption {
+		t.Fatal(err)
+	}
+	err = other.ImportKeys(token, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alg := range []Alg{HS256Alg, HS384Alg, HS512Alg, RS256Alg, ES384Alg, ES512Alg, PS512Alg} {
+		s, _ := Sign(alg, make(Claims), make(Claims), pro)
+		_, _, err = Verify(s, other)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+	}
+	if other.KeyID(ES256Alg) != pro.KeyID(ES256Alg) || other.Recipient(A128GCMEnc).KeyID != pro.Recipient(A128GCMEnc).KeyID {
+		t.FailNow()
+	}
+	// 迭代次数太少
+	token, _ = Encrypt([]byte("{}"), nil, &Recipient{Alg: PBES2HS256A128KWAlg, Enc: A128GCMEnc, Key: "password", P2C: PBES2MinCount}, nil)
+	part := strings.Split(token, ".")
+	header, _ := decodeClaims(part[0])
+	header["p2c"] = 1
+	data, _ := json.Marshal(header)
+	part[0] = base64.RawURLEncoding.EncodeToString(data)
+	_, _, err = Decrypt(strings.Join(part, "."), func(Claims) (interface{}, error) { return "password", nil }, nil)
+	if err != ErrInvalidPBES2Count {
+		t.Fatal(err)
+	}
+	// 迭代次数太多
+	header["p2c"] = PBES2MaxCount + 1
+	data, _ = json.Marshal(header)
+	part[0] = base64.RawURLEncoding.EncodeToString(data)
+	_, _, err = Decrypt(strings.Join(part, "."), func(Claims) (interface{}, error) { return "password", nil }, nil)
+	if err != ErrInvalidPBES2Count {
+		t.Fatal(err)
+	}
+	// KeyFunc返回的hs secret不能当成口令
+	_, _, err = Decrypt(token, func(Claims) (interface{}, error) { return []byte("password"), nil }, nil)
+	if err != ErrUnsupportedKey {
+		t.Fatal(err)
+	}
+}
+
+// 测试对称key集合的gcmkw，dir和用途限制
+func Test_OctetKeySet(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	keys := pro.OctetKeys()
+	_ = keys.Add(&OctetKey{Kid: "kw", Alg: A256GCMKWAlg, Secret: make([]byte, 32), Usage: KeyUsageEncrypt})
+	_ = keys.Add(&OctetKey{Kid: "dir", Alg: DirAlg, Secret: make([]byte, 16), Usage: KeyUsageEncrypt})
+	_ = keys.Add(&OctetKey{Kid: "mac", Alg: HS512Alg, Secret: []byte("mac"), Usage: KeyUsageSign})
+	for _, c := range []struct {
+		kid string
+		alg Alg
+		enc Enc
+	}{
+		{"kw", A256GCMKWAlg, A128CBCHS256Enc},
+		{"dir", DirAlg, A128GCMEnc},
+	} {
+		r, err := keys.Recipient(c.kid, c.alg, c.enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := Encrypt([]byte("plaintext"), nil, r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, b, err := Decrypt(token, pro.DecryptionKey, nil)
+		if err != nil || string(b) != "plaintext" {
+			t.Fatal(c.alg, err)
+		}
+		if c.alg == A256GCMKWAlg && (header["iv"] == nil || header["tag"] == nil) {
+			t.Fatal(header)
+		}
+	}
+	// 签名的secret不能加密，加密的key不能签名，算法限制
+	_, err := keys.Recipient("HS256", DirAlg, A256GCMEnc)
+	if err != ErrKeyUsage {
+		t.Fatal(err)
+	}
+	_, err = keys.Sign(HS256Alg, "kw", make(Claims), make(Claims), nil)
+	if err != ErrKeyUsage {
+		t.Fatal(err)
+	}
+	_, err = keys.Recipient("kw", A128GCMKWAlg, A256GCMEnc)
+	if err != ErrUnsupportedAlg {
+		t.Fatal(err)
+	}
+	// kid选择的hs签名
+	token, err := keys.Sign(HS512Alg, "mac", make(Claims), make(Claims), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = VerifyWithKeyFunc(token, keys.KeyFunc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 导出之后导入
+	exported, _ := pro.ExportKeys("password", PBES2MinCount)
+	other := NewDefaultProvider("", "", "")
+	err = other.ImportKeys(exported, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.OctetKeys().Keys()) != 6 || other.OctetKeys().Get("kw").Usage != KeyUsageEncrypt {
+		t.Fatal(other.OctetKeys().Keys())
+	}
+	// 导入的对称key只有alg决定的一种用途，没有alg或者use和alg不一致的不能导入
+	for _, c := range []struct {
+		alg, use string
+		usage    KeyUsage
+	}{
+		{"HS256", "", KeyUsageSign},
+		{"A128GCMKW", "", KeyUsageEncrypt},
+		{"dir", "enc", KeyUsageEncrypt},
+		{"", "", 0},
+		{"", "sig", 0},
+		{"HS256", "enc", 0},
+		{"A128GCMKW", "sig", 0},
+	} {
+		j, _ := NewPrivateJWK([]byte("0123456789abcdef"), Alg(c.alg), "imported")
+		j.Use = c.use
+		err = other.ImportJWKS(&JWKSet{Keys: []*JWK{j}})
+		if c.usage == 0 {
+			if err == nil {
+				t.Fatal(c.alg, c.use)
+			}
+			continue
+		}
+		if err != nil || other.OctetKeys().Get("imported").Usage != c.usage {
+			t.Fatal(c.alg, c.use, err)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	ErrUnsupportedKey = errors.New("unsupported key")
+	ErrKeyNotFound    = errors.New("key not found")
+)
+
+// rfc7517 json web key
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	// ec
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	// rsa
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// 私钥，ec和okp只有d
+	D  string `json:"d,omitempty"`
+	P  string `json:"p,omitempty"`
+	Q  string `json:"q,omitempty"`
+	DP string `json:"dp,omitempty"`
+	DQ string `json:"dq,omitempty"`
+	QI string `json:"qi,omitempty"`
+	// oct
+	K string `json:"k,omitempty"`
+}
+
+// rfc7517 json web key set
+type JWKSet struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// 查找kid对应的key，kid是空，返回第一个alg相同的
+func (s *JWKSet) Find(kid, alg string) *JWK {
+	for _, k := range s.Keys {
+		if kid != "" {
+			if k.Kid == kid {
+				return k
+			}
+			continue
+		}
+		if k.Alg == alg {
+			return k
+		}
+	}
+	return nil
+}
+
+// 实现KeyFunc，返回header的kid或者alg对应的公钥
+func (s *JWKSet) KeyFunc(header Claims) (interface{}, error) {
+	kid, _ := header["kid"].(string)
+	alg, _ := header["alg"].(string)
+	return jwkPublicKey(s.Find(kid, alg), alg)
+}
+
+// k是nil返回ErrKeyNotFound
+func jwkPublicKey(k *JWK, alg string) (interface{}, error) {
+	if k == nil {
+		return nil, ErrKeyNotFound
+	}
+	// 防止算法混淆
+	if k.Alg != "" && k.Alg != alg {
+		return nil, ErrUnsupportedAlg
+	}
+	return k.PublicKey()
+}
+
+// 公钥的jwk，支持*rsa.PublicKey，*ecdsa.PublicKey，ed25519.PublicKey，私钥会转成公钥
+func NewJWK(key interface{}, alg Alg, kid string) (*JWK, error) {
+	j := new(JWK)
+	j.Alg = string(alg)
+	j.Kid = kid
+	j.Use = "sig"
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		j.setRSA(&k.PublicKey)
+	case *rsa.PublicKey:
+		j.setRSA(k)
+	case *ecdsa.PrivateKey:
+		return j, j.setEC(&k.PublicKey)
+	case *ecdsa.PublicKey:
+		return j, j.setEC(k)
+	case ed25519.PrivateKey:
+		j.setOKP(k.Public().(ed25519.PublicKey))
+	case ed25519.PublicKey:
+		j.setOKP(k)
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return j, nil
+}
+
+// 私钥的jwk，支持*rsa.PrivateKey，*ecdsa.PrivateKey，ed25519.PrivateKey，
+// []byte是对称key
+func NewPrivateJWK(key interface{}, alg Alg, kid string) (*JWK, error) {
+	b64 := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	if k, ok := key.([]byte); ok {
+		j := new(JWK)
+		j.Kty = "oct"
+		j.Alg = string(alg)
+		j.Kid = kid
+		j.K = b64(k)
+		return j, nil
+	}
+	j, err := NewJWK(key, alg, kid)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if len(k.Primes) != 2 {
+			return nil, ErrUnsupportedKey
+		}
+		k.Precompute()
+		j.D = b64(k.D.Bytes())
+		j.P = b64(k.Primes[0].Bytes())
+		j.Q = b64(k.Primes[1].Bytes())
+		j.DP = b64(k.Precomputed.Dp.Bytes())
+		j.DQ = b64(k.Precomputed.Dq.Bytes())
+		j.QI = b64(k.Precomputed.Qinv.Bytes())
+	case *ecdsa.PrivateKey:
+		j.D = b64(k.D.FillBytes(make([]byte, curveSize(&k.PublicKey))))
+	case ed25519.PrivateKey:
+		j.D = b64(k.Seed())
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return j, nil
+}
+
+// 返回*rsa.PrivateKey，*ecdsa.PrivateKey，ed25519.PrivateKey，oct返回[]byte
+func (j *JWK) PrivateKey() (interface{}, error) {
+	if j.Kty == "oct" {
+		k, err := base64.RawURLEncoding.DecodeString(j.K)
+		if err != nil || len(k) < 1 {
+			return nil, ErrUnsupportedKey
+		}
+		return k, nil
+	}
+	if j.D == "" {
+		return nil, ErrUnsupportedKey
+	}
+	pub, err := j.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		key := new(rsa.PrivateKey)
+		key.PublicKey = *k
+		key.D, err = decodeBigInt(j.D)
+		if err != nil {
+			return nil, err
+		}
+		p, err := decodeBigInt(j.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := decodeBigInt(j.Q)
+		if err != nil {
+			return nil, err
+		}
+		key.Primes = []*big.Int{p, q}
+		err = key.Validate()
+		if err != nil {
+			return nil, err
+		}
+		key.Precompute()
+		return key, nil
+	case *ecdsa.PublicKey:
+		d, err := decodeBigInt(j.D)
+		if err != nil {
+			return nil, err
+		}
+		key := new(ecdsa.PrivateKey)
+		key.PublicKey = *k
+		key.D = d
+		// 私钥和公钥必须对应
+		x, y := k.Curve.ScalarBaseMult(d.Bytes())
+		if x.Cmp(k.X) != 0 || y.Cmp(k.Y) != 0 {
+			return nil, ErrUnsupportedKey
+		}
+		return key, nil
+	case ed25519.PublicKey:
+		seed, err := base64.RawURLEncoding.DecodeString(j.D)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, ErrUnsupportedKey
+		}
+		key := ed25519.NewKeyFromSeed(seed)
+		if !k.Equal(key.Public()) {
+			return nil, ErrUnsupportedKey
+		}
+		return key, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+func (j *JWK) setRSA(key *rsa.PublicKey) {
+	j.Kty = "RSA"
+	j.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	j.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+}
+
+func (j *JWK) setEC(key *ecdsa.PublicKey) error {
+	crv, err := curveName(key.Curve)
+	if err != nil {
+		return err
+	}
+	j.Kty = "EC"
+	j.Crv = crv
+	size := curveSize(key)
+	j.X = base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size)))
+	j.Y = base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size)))
+	return nil
+}
+
+func (j *JWK) setOKP(key ed25519.PublicKey) {
+	j.Kty = "OKP"
+	j.Crv = "Ed25519"
+	j.X = base64.RawURLEncoding.EncodeToString(key)
+}
+
+// 返回*rsa.PublicKey，*ecdsa.PublicKey或者ed25519.PublicKey
+func (j *JWK) PublicKey() (interface{}, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, ErrUnsupportedKey
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, err := curveOf(j.Crv)
+		if err != nil {
+			return nil, err
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, ErrUnsupportedKey
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported crv <%s>", j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported kty <%s>", j.Kty)
+	}
+}
+
+// rfc7638 jwk指纹，只使用必须的字段，按照字典序
+func (j *JWK) Thumbprint(h crypto.Hash) (string, error) {
+	// json字符串，jwk的值是不可信的，不能用%q
+	q := func(v string) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	var s string
+	switch j.Kty {
+	case "RSA":
+		s = `{"e":` + q(j.E) + `,"kty":"RSA","n":` + q(j.N) + `}`
+	case "EC":
+		s = `{"crv":` + q(j.Crv) + `,"kty":"EC","x":` + q(j.X) + `,"y":` + q(j.Y) + `}`
+	case "OKP":
+		s = `{"crv":` + q(j.Crv) + `,"kty":"OKP","x":` + q(j.X) + `}`
+	case "oct":
+		s = `{"k":` + q(j.K) + `,"kty":"oct"}`
+	default:
+		return "", fmt.Errorf("unsupported kty <%s>", j.Kty)
+	}
+	if !h.Available() {
+		return "", ErrUnsupportedAlg
+	}
+	d := h.New()
+	d.Write([]byte(s))
+	return base64.RawURLEncoding.EncodeToString(d.Sum(nil)), nil
+}
+
+// key的rfc7638指纹，key和NewJWK支持的一样
+func Thumbprint(key interface{}, h crypto.Hash) (string, error) {
+	j, err := NewJWK(key, "", "")
+	if err != nil {
+		return "", err
+	}
+	return j.Thumbprint(h)
+}
+
+// key的sha256指纹，用于cnf.jkt和dpop
+func JKT(key interface{}) (string, error) {
+	return Thumbprint(key, crypto.SHA256)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, ErrUnsupportedKey
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func curveName(curve elliptic.Curve) (string, error) {
+	switch curve {
+	case elliptic.P256():
+		return "P-256", nil
+	case elliptic.P384():
+		return "P-384", nil
+	case elliptic.P521():
+		return "P-521", nil
+	default:
+		return "", ErrUnsupportedKey
+	}
+}
+
+func curveOf(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, fmt.Errorf("unsupported crv <%s>", name)
+	}
+}
+
+// es算法使用的曲线名称，不是es算法返回空字符串
+func curveOfAlg(alg Alg) string {
+	switch alg {
+	case ES256Alg:
+		return "P-256"
+	case ES384Alg:
+		return "P-384"
+	case ES512Alg:
+		return "P-521"
+	default:
+		return ""
+	}
+}
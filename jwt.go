@@ -1,14 +1,13 @@
 package jwt
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"math/big"
-	"math/bits"
 	"strings"
 )
 
@@ -41,8 +40,19 @@ const (
 	ES512Alg Alg = "ES512"
 )
 
-// es算法的缓存长度
-const _s = bits.UintSize / 8
+// 算法使用的sha2哈希，和Verify的选择一致，不支持的算法返回0
+func (a Alg) Hash() crypto.Hash {
+	switch strings.ToUpper(string(a)) {
+	case "HS256", "RS256", "ES256", "PS256":
+		return crypto.SHA256
+	case "HS384", "RS384", "ES384", "PS384":
+		return crypto.SHA384
+	case "HS512", "RS512", "ES512", "PS512":
+		return crypto.SHA512
+	default:
+		return 0
+	}
+}
 
 // es算法结果
 type bigint struct {
@@ -50,37 +60,17 @@ type bigint struct {
 	r, s big.Int
 }
 
-// go/src/math/big/nat.go func (z nat) bytes(buf []byte) (i int)， go/src/math/big/int.go func (x *Int) Bytes() []byte
-func (b *bigint) Encode(r, s *big.Int) []byte {
-	sz, rz := s.Bits(), r.Bits()
-	n := (len(sz) + len(rz)) * _s
+// 按照rfc7518，r和s都编码成曲线长度的定长大端字节
+func (b *bigint) Encode(r, s *big.Int, size int) []byte {
+	n := size * 2
 	if cap(b.b) < n {
 		b.b = make([]byte, n)
 	} else {
 		b.b = b.b[:n]
 	}
-	i := len(b.b)
-	for _, d := range sz {
-		for j := 0; j < _s; j++ {
-			i--
-			b.b[i] = byte(d)
-			d >>= 8
-		}
-	}
-	for i < len(b.b) && b.b[i] == 0 {
-		i++
-	}
-	for _, d := range rz {
-		for j := 0; j < _s; j++ {
-			i--
-			b.b[i] = byte(d)
-			d >>= 8
-		}
-	}
-	for i < len(b.b) && b.b[i] == 0 {
-		i++
-	}
-	return b.b[i:]
+	r.FillBytes(b.b[:size])
+	s.FillBytes(b.b[size:])
+	return b.b
 }
 
 func (b *bigint) Decode(buf []byte) {
@@ -90,7 +80,7 @@ func (b *bigint) Decode(buf []byte) {
 }
 
 func GenRSPem() (string, string) {
-	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key, _ := rsa.GenerateKey(DefaultConfig.random(), 2048)
 	data := x509.MarshalPKCS1PrivateKey(key)
 	block := pem.Block{
 		Type:    "RSA PRIVATE KEY",
@@ -137,16 +127,21 @@ func genESPem(key *ecdsa.PrivateKey) (string, string) {
 }
 
 func GenES256Pem() (string, string) {
-	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), DefaultConfig.random())
 	return genESPem(key)
 }
 
 func GenES384Pem() (string, string) {
-	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), DefaultConfig.random())
 	return genESPem(key)
 }
 
 func GenES512Pem() (string, string) {
-	key, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	key, _ := ecdsa.GenerateKey(elliptic.P521(), DefaultConfig.random())
 	return genESPem(key)
 }
+
+// 曲线的字节长度
+func curveSize(key *ecdsa.PublicKey) int {
+	return (key.Curve.Params().BitSize + 7) / 8
+}
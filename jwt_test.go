@@ -2,8 +2,19 @@ package jwt
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	mathrand "math/rand"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // 测试签名和验证
@@ -38,7 +49,14 @@ func Test_SignAndVerify(t *testing.T) {
 		}
 		h, p, e := Verify(buffer.String(), pro)
 		if e != nil {
-			t.Fatal(e)
+			t.Fatal(alg[i], e)
+		}
+		// header在不同的算法之间重复使用，kid是当前算法的
+		if h["alg"] != string(alg[i]) || h["kid"] != nil && h["kid"] != pro.KeyID(alg[i]) {
+			t.Fatal(alg[i], h)
+		}
+		if len(header) != 2 {
+			t.Fatal(header)
 		}
 		v1, o := h["test1"].(float64)
 		if !o || v1 != 1 {
@@ -59,6 +77,372 @@ func Test_SignAndVerify(t *testing.T) {
 	}
 }
 
+// 测试SetHS384Key和SetHS512Key使用sha384和sha512，和WithSecret的结果相同
+func Test_SetHSKey(t *testing.T) {
+	pro := NewDefaultProvider("", "", "")
+	pro.SetHS384Key("new384")
+	pro.SetHS512Key("new512")
+	token, _ := SignHS384WithSecret(make(Claims), make(Claims), "new384")
+	_, _, err := Verify(token, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ = SignHS512WithSecret(make(Claims), make(Claims), "new512")
+	_, _, err = Verify(token, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ = Sign(HS384Alg, make(Claims), make(Claims), pro)
+	_, _, err = VerifyWithKeyFunc(token, func(Claims) (interface{}, error) { return []byte("new384"), nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 测试签名验证和更换hs的secret同时进行，使用-race运行
+func Test_SetHSKeyConcurrent(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			pro.SetHS256Key("hs256")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		token, err := Sign(HS256Alg, make(Claims), make(Claims), pro)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = Verify(token, pro)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	// 换了secret，旧的不能验证
+	token, _ := Sign(HS256Alg, make(Claims), make(Claims), pro)
+	pro.SetHS256Key("new")
+	_, _, err := Verify(token, pro)
+	if err != ErrInvalidToken {
+		t.Fatal(err)
+	}
+}
+
+// 测试payload的设置和签名时的自动填充
+func Test_Payload(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	payload := NewPayload()
+	payload.SetISS("issuer")
+	payload.SetAUD("a", "b")
+	payload.SetEXP(time.Hour)
+	token, err := Sign(HS256Alg, make(Claims), Claims(payload), pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p, err := Verify(token, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p["iss"] != "issuer" {
+		t.FailNow()
+	}
+	aud, o := p["aud"].([]interface{})
+	if !o || len(aud) != 2 || aud[0] != "a" || aud[1] != "b" {
+		t.FailNow()
+	}
+	// 自动填充不修改调用者的payload
+	if _, o := payload["jti"]; o {
+		t.FailNow()
+	}
+	if _, o := payload["iat"]; o {
+		t.FailNow()
+	}
+	jti, o := p["jti"].(string)
+	if !o || jti == "" {
+		t.FailNow()
+	}
+	// 同一个payload再次签名，jti不同
+	token2, err := Sign(HS256Alg, make(Claims), Claims(payload), pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p2, err := Verify(token2, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p2["jti"] == jti {
+		t.FailNow()
+	}
+	iat, o := p["iat"].(float64)
+	if !o || int64(iat) > time.Now().Unix() {
+		t.FailNow()
+	}
+	exp, o := p["exp"].(float64)
+	if !o || int64(exp)-int64(iat) < 3599 {
+		t.FailNow()
+	}
+}
+
+// 测试注入的时间和随机数来源，es签名使用rfc6979所以结果相同，
+// 注入的Rand不能让生成的key相同，看Config.Rand的说明
+func Test_Config(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	config := &Config{
+		Clock:           ClockFunc(func() time.Time { return now }),
+		Rand:            mathrand.New(mathrand.NewSource(1)),
+		DeterministicES: true,
+	}
+	pro := NewDefaultProviderWithConfig(config, "hs256", "hs384", "hs512")
+	for _, a := range []Alg{ES256Alg, ES384Alg, ES512Alg} {
+		payload := make(Claims)
+		payload["exp"] = now.Add(time.Hour).Unix()
+		payload["jti"] = "1"
+		token1, err := Sign(a, make(Claims), payload, pro)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = make(Claims)
+		payload["exp"] = now.Add(time.Hour).Unix()
+		payload["jti"] = "1"
+		token2, err := Sign(a, make(Claims), payload, pro)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token1 != token2 {
+			t.Fatal(a, "not deterministic")
+		}
+		_, _, err = Verify(token1, pro)
+		if err != nil {
+			t.Fatal(a, err)
+		}
+		// 过期
+		now = now.Add(2 * time.Hour)
+		_, _, err = Verify(token1, pro)
+		if err != ErrTokenExpired {
+			t.Fatal(a, err)
+		}
+		now = now.Add(-2 * time.Hour)
+	}
+}
+
+// 测试rfc6979附录A.2.5/A.2.6/A.2.7的例子，sha256，消息是sample和test
+func Test_RFC6979(t *testing.T) {
+	hexInt := func(s string) *big.Int {
+		i, _ := new(big.Int).SetString(s, 16)
+		return i
+	}
+	for _, c := range []struct {
+		curve     elliptic.Curve
+		d, x, y   string
+		msg, r, s string
+	}{
+		// A.2.5 P-256
+		{
+			elliptic.P256(),
+			"C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+			"60FED4BA255A9D31C961EB74C6356D68C049B8923B61FA6CE669622E60F29FB6",
+			"7903FE1008B8BC99A41AE9E95628BC64F2F1B20C2D7E9F5177A3C294D4462299",
+			"sample",
+			"EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716",
+			"F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8",
+		},
+		{
+			elliptic.P256(),
+			"C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721",
+			"60FED4BA255A9D31C961EB74C6356D68C049B8923B61FA6CE669622E60F29FB6",
+			"7903FE1008B8BC99A41AE9E95628BC64F2F1B20C2D7E9F5177A3C294D4462299",
+			"test",
+			"F1ABB023518351CD71D881567B1EA663ED3EFCF6C5132B354F28D3B0B7D38367",
+			"019F4113742A2B14BD25926B49C649155F267E60D3814B4C0CC84250E46F0083",
+		},
+		// A.2.6 P-384
+		{
+			elliptic.P384(),
+			"6B9D3DAD2E1B8C1C05B19875B6659F4DE23C3B667BF297BA9AA47740787137D896D5724E4C70A825F872C9EA60D2EDF5",
+			"EC3A4E415B4E19A4568618029F427FA5DA9A8BC4AE92E02E06AAE5286B300C64DEF8F0EA9055866064A254515480BC13",
+			"8015D9B72D7D57244EA8EF9AC0C621896708A59367F9DFB9F54CA84B3F1C9DB1288B231C3AE0D4FE7344FD2533264720",
+			"sample",
+			"21B13D1E013C7FA1392D03C5F99AF8B30C570C6F98D4EA8E354B63A21D3DAA33BDE1E888E63355D92FA2B3C36D8FB2CD",
+			"F3AA443FB107745BF4BD77CB3891674632068A10CA67E3D45DB2266FA7D1FEEBEFDC63ECCD1AC42EC0CB8668A4FA0AB0",
+		},
+		{
+			elliptic.P384(),
+			"6B9D3DAD2E1B8C1C05B19875B6659F4DE23C3B667BF297BA9AA47740787137D896D5724E4C70A825F872C9EA60D2EDF5",
+			"EC3A4E415B4E19A4568618029F427FA5DA9A8BC4AE92E02E06AAE5286B300C64DEF8F0EA9055866064A254515480BC13",
+			"8015D9B72D7D57244EA8EF9AC0C621896708A59367F9DFB9F54CA84B3F1C9DB1288B231C3AE0D4FE7344FD2533264720",
+			"test",
+			"6D6DEFAC9AB64DABAFE36C6BF510352A4CC27001263638E5B16D9BB51D451559F918EEDAF2293BE5B475CC8F0188636B",
+			"2D46F3BECBCC523D5F1A1256BF0C9B024D879BA9E838144C8BA6BAEB4B53B47D51AB373F9845C0514EEFB14024787265",
+		},
+		// A.2.7 P-521
+		{
+			elliptic.P521(),
+			"0FAD06DAA62BA3B25D2FB40133DA757205DE67F5BB0018FEE8C86E1B68C7E75CAA896EB32F1F47C70855836A6D16FCC1466F6D8FBEC67DB89EC0C08B0E996B83538",
+			"1894550D0785932E00EAA23B694F213F8C3121F86DC97A04E5A7167DB4E5BCD371123D46E45DB6B5D5370A7F20FB633155D38FFA16D2BD761DCAC474B9A2F5023A4",
+			"0493101C962CD4D2FDDF782285E64584139C2F91B47F87FF82354D6630F746A28A0DB25741B5B34A828008B22ACC23F924FAAFBD4D33F81EA66956DFEAA2BFDFCF5",
+			"sample",
+			"1511BB4D675114FE266FC4372B87682BAECC01D3CC62CF2303C92B3526012659D16876E25C7C1E57648F23B73564D67F61C6F14D527D54972810421E7D87589E1A7",
+			"04A171143A83163D6DF460AAF61522695F207A58B95C0644D87E52AA1A347916E4F7A72930B1BC06DBE22CE3F58264AFD23704CBB63B29B931F7DE6C9D949A7ECFC",
+		},
+		{
+			elliptic.P521(),
+			"0FAD06DAA62BA3B25D2FB40133DA757205DE67F5BB0018FEE8C86E1B68C7E75CAA896EB32F1F47C70855836A6D16FCC1466F6D8FBEC67DB89EC0C08B0E996B83538",
+			"1894550D0785932E00EAA23B694F213F8C3121F86DC97A04E5A7167DB4E5BCD371123D46E45DB6B5D5370A7F20FB633155D38FFA16D2BD761DCAC474B9A2F5023A4",
+			"0493101C962CD4D2FDDF782285E64584139C2F91B47F87FF82354D6630F746A28A0DB25741B5B34A828008B22ACC23F924FAAFBD4D33F81EA66956DFEAA2BFDFCF5",
+			"test",
+			"00E871C4A14F993C6C7369501900C4BC1E9C7B0B4BA44E04868B30B41D8071042EB28C4C250411D0CE08CD197E4188EA4876F279F90B3D8D74A3C76E6F1E4656AA8",
+			"0CD52DBAA33B063C3A6CD8058A1FB0A46A4754B034FCC644766CA14DA8CA5CA9FDE00E88C1AD60CCBA759025299079D7A427EC3CC5B619BFBC828E7769BCD694E86",
+		},
+	} {
+		key := &ecdsa.PrivateKey{D: hexInt(c.d)}
+		key.Curve = c.curve
+		key.X = hexInt(c.x)
+		key.Y = hexInt(c.y)
+		digest := sha256.Sum256([]byte(c.msg))
+		r, s, err := signRFC6979(key, digest[:], sha256.New)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Cmp(hexInt(c.r)) != 0 || s.Cmp(hexInt(c.s)) != 0 {
+			t.Fatal(c.curve.Params().Name, c.msg, r.Text(16), s.Text(16))
+		}
+		if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+			t.Fatal(c.curve.Params().Name, c.msg)
+		}
+	}
+}
+
+// 测试rfc7638和rfc8037的例子，以及DefaultProvider的kid
+func Test_Thumbprint(t *testing.T) {
+	j := &JWK{
+		Kty: "RSA",
+		E:   "AQAB",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	s, err := j.Thumbprint(crypto.SHA256)
+	if err != nil || s != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatal(s, err)
+	}
+	j = &JWK{Kty: "OKP", Crv: "Ed25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	s, err = j.Thumbprint(crypto.SHA256)
+	if err != nil || s != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Fatal(s, err)
+	}
+	key, err := j.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ = JKT(key)
+	if s != "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k" {
+		t.Fatal(s)
+	}
+	// 签名自动填充kid
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	token, _ := Sign(ES256Alg, make(Claims), make(Claims), pro)
+	h, _, err := Verify(token, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := JKT(pro.ES256Key())
+	if kid == "" || h["kid"] != kid || pro.JWKS().Find(kid, "").Alg != "ES256" {
+		t.FailNow()
+	}
+}
+
+// 测试hkdf派生租户key
+func Test_TenantKeys(t *testing.T) {
+	// rfc5869 a.1
+	ikm, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	okm := hkdf(sha256.New, ikm, salt, info, 42)
+	if hex.EncodeToString(okm) != "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865" {
+		t.Fatal(hex.EncodeToString(okm))
+	}
+	_, err := NewTenantKeys("m:1", []byte("master1"), 2)
+	if err != ErrInvalidMasterID {
+		t.Fatal(err)
+	}
+	keys, err := NewTenantKeys("m1", []byte("master1"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.AddMaster("m:2", []byte("master2")) != ErrInvalidMasterID || keys.Rotate("", []byte("master2")) != ErrInvalidMasterID {
+		t.FailNow()
+	}
+	token1, err := keys.Sign(HS256Alg, "t1", make(Claims), make(Claims))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token2, _ := keys.Sign(HS512Alg, "t2", make(Claims), make(Claims))
+	_, payload, err := keys.Verify(token1)
+	if err != nil || payload["tid"] != "t1" {
+		t.Fatal(err)
+	}
+	_, _, err = VerifyWithKeyFunc(token2, keys.KeyFunc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 别的租户的key
+	k, _ := keys.Key("m1", "t2", HS256Alg)
+	payload = make(Claims)
+	payload["tid"] = "t1"
+	forged, _ := SignWithKey(HS256Alg, Claims{"kid": "m1:t1"}, payload, k, nil)
+	_, _, err = keys.Verify(forged)
+	if err != ErrInvalidToken {
+		t.Fatal(err)
+	}
+	// 租户和kid不一致
+	payload["tid"] = "t2"
+	forged, _ = SignWithKey(HS256Alg, Claims{"kid": "m1:t1"}, payload, k, nil)
+	_, _, err = keys.Verify(forged)
+	if err != ErrInvalidTenant {
+		t.Fatal(err)
+	}
+	// 没有kid，使用租户字段
+	forged, _ = SignWithKey(HS256Alg, make(Claims), payload, k, nil)
+	_, _, err = keys.Verify(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.cache.len() != 2 {
+		t.Fatal(keys.cache.len())
+	}
+	// 轮换主密钥，旧的token还可以验证，直到删除
+	_ = keys.Rotate("m2", []byte("master2"))
+	token3, _ := keys.Sign(HS256Alg, "t1", make(Claims), make(Claims))
+	for _, token := range []string{token1, token3} {
+		_, _, err = keys.Verify(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys.RemoveMaster("m1")
+	_, _, err = keys.Verify(token1)
+	if err != ErrKeyNotFound {
+		t.Fatal(err)
+	}
+	// 派生的同时换了同一个id的主密钥，最后缓存的是新的主密钥派生的key
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			_ = keys.AddMaster("m3", []byte{byte(i)})
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		_, _ = keys.Key("m3", "t1", HS256Alg)
+	}
+	wg.Wait()
+	k, _ = keys.Key("m3", "t1", HS256Alg)
+	if !bytes.Equal(k, hkdf(sha256.New, []byte{199}, nil, []byte("jwt HS256 t1"), 32)) {
+		t.FailNow()
+	}
+}
+
 func benchmarkSign(b *testing.B, a Alg) {
 	pro := NewDefaultProvider("hs256", "hs384", "hs512")
 	var buf bytes.Buffer
@@ -189,3 +573,135 @@ func Benchmark_Verify_PS384(b *testing.B) {
 func Benchmark_Verify_PS512(b *testing.B) {
 	benchmarkVerify(b, "PS512")
 }
+
+// 测试key的有效期
+func Test_KeyLifetime(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	config := &Config{Clock: ClockFunc(func() time.Time { return now })}
+	pro := NewDefaultProviderWithConfig(config, "hs256", "", "")
+	pro.SetKeyLifetime(HS256Alg, &KeyLifetime{
+		NotBefore: now,
+		NotAfter:  now.Add(time.Hour),
+		Grace:     time.Hour,
+	})
+	token, err := Sign(HS256Alg, make(Claims), Claims{"iat": now.Unix()}, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 签名之前的iat
+	early, _ := Sign(HS256Alg, make(Claims), Claims{"iat": now.Add(-time.Minute).Unix()}, pro)
+	_, _, err = Verify(early, pro)
+	if err != ErrKeyLifetime {
+		t.Fatal(err)
+	}
+	// 停止签名，还在宽限期内
+	now = now.Add(90 * time.Minute)
+	_, err = Sign(HS256Alg, make(Claims), make(Claims), pro)
+	if err != ErrKeyExpired {
+		t.Fatal(err)
+	}
+	// 复用的signer不能带着provider的有效期
+	_, err = SignWithKey(HS256Alg, make(Claims), make(Claims), []byte("key"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = SignHS256WithSecret(make(Claims), make(Claims), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Verify(token, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 退役
+	now = now.Add(time.Hour)
+	_, _, err = Verify(token, pro)
+	if err != ErrKeyRetired {
+		t.Fatal(err)
+	}
+	// 设置新的key清除有效期
+	pro.SetHS256Key("hs256")
+	_, _, err = Verify(token, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 测试签名和验证的hooks
+func Test_Hooks(t *testing.T) {
+	var log bytes.Buffer
+	audit := NewAuditLogHooks(&log)
+	vars := NewExpvarHooks("jwt_test_hooks")
+	config := &Config{Hooks: NewMultiHooks(vars, audit)}
+	pro := NewDefaultProviderWithConfig(config, "secret", "", "")
+	pro.GenES256Key()
+	token, err := Sign(ES256Alg, make(Claims), Claims{"iss": "a"}, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Verify(token, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := Sign(HS256Alg, make(Claims), Claims{"exp": time.Now().Add(-time.Hour).Unix()}, pro)
+	_, _, err = Verify(expired, pro)
+	if err != ErrTokenExpired {
+		t.Fatal(err)
+	}
+	_, _, err = VerifyWithKeyFunc("e30.e30.", func(Claims) (interface{}, error) { return nil, ErrKeyNotFound }, config)
+	if err == nil {
+		t.FailNow()
+	}
+	for k, v := range map[string]string{
+		"sign.ES256.success":             "1",
+		"verify.ES256.success":           "1",
+		"sign.HS256.success":             "1",
+		"verify.HS256.failure.expired":   "1",
+		"verify.unknown.failure.invalid": "1",
+	} {
+		if vars.vars.Get(k) == nil || vars.vars.Get(k).String() != v {
+			t.Fatal(k, vars.vars.Get(k))
+		}
+	}
+	if !strings.Contains(vars.vars.Get("verify.ES256.latency").String(), `"count":1`) {
+		t.Fatal(vars.vars.Get("verify.ES256.latency"))
+	}
+	lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+	if len(lines) != 5 || strings.Contains(log.String(), token) || strings.Contains(log.String(), "secret") {
+		t.Fatal(log.String())
+	}
+	if !strings.Contains(lines[1], `"kid":"`+pro.KeyID(ES256Alg)+`"`) || !strings.Contains(lines[1], `"iss":"a"`) {
+		t.Fatal(lines[1])
+	}
+	// 所有算法的签名错误是同一个分类
+	other := NewDefaultProvider("other", "", "")
+	for _, alg := range []Alg{HS256Alg, RS256Alg, ES384Alg, PS512Alg} {
+		token, _ := Sign(alg, make(Claims), make(Claims), other)
+		_, _, err = Verify(token, pro)
+		if err != ErrInvalidToken {
+			t.Fatal(alg, err)
+		}
+		if k := "verify." + string(alg) + ".failure.invalid"; vars.vars.Get(k) == nil || vars.vars.Get(k).String() != "1" {
+			t.Fatal(k, vars.vars.Get(k))
+		}
+	}
+	// 小写的alg和大写的是同一个变量
+	data := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"hs256"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{}`))
+	m := hmac.New(sha256.New, []byte("secret"))
+	m.Write([]byte(data))
+	_, _, err = Verify(data+"."+base64.RawURLEncoding.EncodeToString(m.Sum(nil)), pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars.vars.Get("verify.hs256.success") != nil || vars.vars.Get("verify.HS256.success").String() != "1" {
+		t.Fatal(vars.vars.Get("verify.HS256.success"))
+	}
+	// 审计日志使用config的时间
+	log.Reset()
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	config = &Config{Clock: ClockFunc(func() time.Time { return now }), Hooks: audit}
+	_, _ = SignWithKey(HS256Alg, make(Claims), make(Claims), []byte("secret"), config)
+	if !strings.Contains(log.String(), `"time":"2020-01-02T03:04:05Z"`) {
+		t.Fatal(log.String())
+	}
+}
@@ -0,0 +1,264 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// 管理接口的路径，使用http.StripPrefix挂载
+const (
+	KeyAdminKeysPath   = "/keys"        // GET列出所有的key
+	KeyAdminRotatePath = "/keys/rotate" // POST alg，生成新的key
+	KeyAdminRevokePath = "/keys/revoke" // POST kid，吊销key
+	KeyAdminJWKSPath   = "/jwks"        // GET导出公钥，POST导入公钥
+)
+
+// 管理接口的操作
+const (
+	KeyAdminList   = "list"
+	KeyAdminRotate = "rotate"
+	KeyAdminRevoke = "revoke"
+	KeyAdminExport = "export"
+	KeyAdminImport = "import"
+)
+
+// 导入的jwk set的最大字节
+const maxKeyAdminBody = 1 << 20
+
+var (
+	ErrForbidden = errors.New("forbidden")
+)
+
+// 检查请求是否可以执行action，返回调用者的标识，用于审计
+type KeyAdminAuthorizer func(r *http.Request, action string) (actor string, err error)
+
+// 修改key的审计事件，不包含key的内容
+type KeyAuditEvent struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Remote string    `json:"remote"`
+	Action string    `json:"action"`
+	Kid    string    `json:"kid,omitempty"`
+	Alg    Alg       `json:"alg,omitempty"`
+	Error  string    `json:"error,omitempty"` // 失败的原因
+}
+
+// 列表中的key
+type keyAdminInfo struct {
+	KeyMeta
+	Public bool  `json:"public"` // 导入的公钥
+	Age    int64 `json:"age"`    // NotBefore之后的秒数
+}
+
+func NewKeyAdminHandler(store *FileKeyStore, authorize KeyAdminAuthorizer) *KeyAdminHandler {
+	h := new(KeyAdminHandler)
+	h.Store = store
+	h.Authorize = authorize
+	return h
+}
+
+// key管理接口，吊销的key马上同步到Store.Provider
+type KeyAdminHandler struct {
+	Store     *FileKeyStore
+	Authorize KeyAdminAuthorizer   // nil拒绝所有的请求
+	Audit     func(*KeyAuditEvent) // rotate，revoke和import的审计，包括失败的
+}
+
+func (h *KeyAdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var action, method string
+	switch r.URL.Path {
+	case KeyAdminKeysPath:
+		action, method = KeyAdminList, http.MethodGet
+	case KeyAdminRotatePath:
+		action, method = KeyAdminRotate, http.MethodPost
+	case KeyAdminRevokePath:
+		action, method = KeyAdminRevoke, http.MethodPost
+	case KeyAdminJWKSPath:
+		action, method = KeyAdminExport, http.MethodGet
+		if r.Method == http.MethodPost {
+			action, method = KeyAdminImport, http.MethodPost
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	e := new(KeyAuditEvent)
+	e.Time = h.Store.config.now()
+	e.Remote = r.RemoteAddr
+	e.Action = action
+	var err error
+	if h.Authorize == nil {
+		err = ErrForbidden
+	} else {
+		e.Actor, err = h.Authorize(r, action)
+	}
+	if err != nil {
+		if action == KeyAdminRotate || action == KeyAdminRevoke || action == KeyAdminImport {
+			e.Error = ErrForbidden.Error()
+			h.audit(e)
+		}
+		writeKeyAdminError(w, http.StatusForbidden, ErrForbidden)
+		return
+	}
+	switch action {
+	case KeyAdminList:
+		h.list(w)
+	case KeyAdminExport:
+		writeJSON(w, http.StatusOK, h.Store.JWKS())
+	case KeyAdminRotate:
+		h.rotate(w, r, e)
+	case KeyAdminRevoke:
+		h.revoke(w, r, e)
+	default:
+		h.importJWKS(w, r, e)
+	}
+}
+
+func (h *KeyAdminHandler) audit(e *KeyAuditEvent) {
+	if h.Audit != nil {
+		h.Audit(e)
+	}
+}
+
+func (h *KeyAdminHandler) info(k *StoredKey, now time.Time) *keyAdminInfo {
+	i := new(keyAdminInfo)
+	i.KeyMeta = k.KeyMeta
+	i.Public = isPublicKey(k.Key)
+	if !k.NotBefore.IsZero() && now.After(k.NotBefore) {
+		i.Age = int64(now.Sub(k.NotBefore) / time.Second)
+	}
+	return i
+}
+
+func (h *KeyAdminHandler) list(w http.ResponseWriter) {
+	now := h.Store.config.now()
+	res := make([]*keyAdminInfo, 0)
+	for _, k := range h.Store.Keys() {
+		res = append(res, h.info(k, now))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h *KeyAdminHandler) rotate(w http.ResponseWriter, r *http.Request, e *KeyAuditEvent) {
+	e.Alg = Alg(r.FormValue("alg"))
+	k, err := h.Store.Rotate(e.Alg)
+	if err != nil {
+		e.Error = err.Error()
+		h.audit(e)
+		writeKeyAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	e.Kid = k.Kid
+	h.audit(e)
+	writeJSON(w, http.StatusOK, h.info(k, e.Time))
+}
+
+func (h *KeyAdminHandler) revoke(w http.ResponseWriter, r *http.Request, e *KeyAuditEvent) {
+	e.Kid = r.FormValue("kid")
+	if k := h.Store.Get(e.Kid); k != nil {
+		e.Alg = k.Alg
+	}
+	err := h.Store.SetStatus(e.Kid, KeyStatusRevoked)
+	if err != nil {
+		e.Error = err.Error()
+		h.audit(e)
+		status := http.StatusInternalServerError
+		if err == ErrKeyNotFound {
+			status = http.StatusNotFound
+		}
+		writeKeyAdminError(w, status, err)
+		return
+	}
+	h.audit(e)
+	writeJSON(w, http.StatusOK, h.info(h.Store.Get(e.Kid), e.Time))
+}
+
+// 导入jwk set中的公钥，每个key一个审计事件，
+// 先检查所有的key，然后一次保存，失败时一个都不导入
+func (h *KeyAdminHandler) importJWKS(w http.ResponseWriter, r *http.Request, e *KeyAuditEvent) {
+	set := new(JWKSet)
+	err := json.NewDecoder(io.LimitReader(r.Body, maxKeyAdminBody)).Decode(set)
+	if err != nil {
+		e.Error = err.Error()
+		h.audit(e)
+		writeKeyAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	events := make([]*KeyAuditEvent, len(set.Keys))
+	keys := make([]*StoredKey, len(set.Keys))
+	for i, j := range set.Keys {
+		ke := *e
+		ke.Kid = j.Kid
+		ke.Alg = Alg(j.Alg)
+		events[i] = &ke
+		keys[i], err = importJWK(j, e.Time)
+		if err != nil {
+			ke.Error = err.Error()
+			h.audit(&ke)
+			writeKeyAdminError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	err = h.Store.Add(keys...)
+	for _, ke := range events {
+		if err != nil {
+			ke.Error = err.Error()
+		}
+		h.audit(ke)
+	}
+	if err != nil {
+		writeKeyAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	res := make([]*keyAdminInfo, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, h.info(k, e.Time))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// 只接受带有kid和alg的公钥，kty和crv必须和alg一致
+func importJWK(j *JWK, now time.Time) (*StoredKey, error) {
+	if j.Kid == "" || j.Alg == "" || j.Kty == "oct" || j.D != "" {
+		return nil, ErrUnsupportedKey
+	}
+	alg := Alg(j.Alg)
+	if alg.Hash() == 0 {
+		return nil, ErrUnsupportedAlg
+	}
+	switch alg {
+	case RS256Alg, RS384Alg, RS512Alg, PS256Alg, PS384Alg, PS512Alg:
+		if j.Kty != "RSA" {
+			return nil, ErrUnsupportedKey
+		}
+	case ES256Alg, ES384Alg, ES512Alg:
+		if j.Kty != "EC" || j.Crv != curveOfAlg(alg) {
+			return nil, ErrUnsupportedKey
+		}
+	default:
+		return nil, ErrUnsupportedAlg
+	}
+	pub, err := j.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	k := new(StoredKey)
+	k.Kid = j.Kid
+	k.Alg = alg
+	k.Status = KeyStatusActive
+	k.NotBefore = now.UTC()
+	k.Key = pub
+	return k, nil
+}
+
+func writeKeyAdminError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,603 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// key的状态
+type KeyStatus string
+
+const (
+	KeyStatusActive  KeyStatus = "active"  // 签名和验证
+	KeyStatusRetired KeyStatus = "retired" // 只用于验证
+	KeyStatusRevoked KeyStatus = "revoked" // 不能使用
+)
+
+// 目录中的元数据文件
+const KeyStoreMetaFile = "keys.json"
+
+// 默认的key退役之后还可以验证的时间
+const DefaultKeyGrace = 24 * time.Hour
+
+var (
+	ErrKeyStoreMasterKey = errors.New("keystore master key required")
+)
+
+// key的元数据
+type KeyMeta struct {
+	Kid       string    `json:"kid"`
+	Alg       Alg       `json:"alg"`
+	Status    KeyStatus `json:"status"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"` // 零值表示不过期
+	File      string    `json:"file"`      // 目录中的文件名，.pem，.jwk或者.jwe
+}
+
+// keystore中的key，Key是私钥，hs算法是[]byte
+type StoredKey struct {
+	KeyMeta
+	Key interface{}
+}
+
+// 元数据中的有效期
+func (k *StoredKey) lifetime(grace time.Duration) *KeyLifetime {
+	l := new(KeyLifetime)
+	l.NotBefore = k.NotBefore
+	l.NotAfter = k.NotAfter
+	l.Grace = grace
+	return l
+}
+
+// 目录中的元数据文件
+type keyStoreMeta struct {
+	Keys []*KeyMeta `json:"keys"`
+}
+
+// master是32字节，不为nil时新的key使用A256GCMKW加密保存成.jwe，
+// dir不存在会创建
+func NewFileKeyStore(dir string, master []byte, config *Config) (*FileKeyStore, error) {
+	if master != nil && len(master) != 32 {
+		return nil, ErrKeyStoreMasterKey
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	s := new(FileKeyStore)
+	s.dir = dir
+	s.master = master
+	s.config = config
+	s.Grace = DefaultKeyGrace
+	if s.config == nil {
+		s.config = DefaultConfig
+	}
+	err = s.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// 使用目录保存key，keys.json是元数据，每个key一个文件
+type FileKeyStore struct {
+	// 不为nil，加载之后把active的key设置到provider
+	Provider *DefaultProvider
+	// Watch重新加载失败的回调
+	OnError func(error)
+	// key的NotAfter之后还可以验证的时间，默认DefaultKeyGrace
+	Grace   time.Duration
+	dir     string
+	master  []byte
+	config  *Config
+	lock    sync.RWMutex
+	keys    []*StoredKey
+	version string // 目录中文件的名称，修改时间和大小
+}
+
+// 所有的key
+func (s *FileKeyStore) Keys() []*StoredKey {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	keys := make([]*StoredKey, len(s.keys))
+	copy(keys, s.keys)
+	return keys
+}
+
+// 没有返回nil
+func (s *FileKeyStore) Get(kid string) *StoredKey {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, k := range s.keys {
+		if k.Kid == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+// 重新加载所有的key，全部成功之后才替换
+func (s *FileKeyStore) Reload() error {
+	version, err := s.dirVersion()
+	if err != nil {
+		return err
+	}
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.keys = keys
+	s.version = version
+	s.lock.Unlock()
+	return s.apply(keys)
+}
+
+// 目录中的文件有变化才重新加载
+func (s *FileKeyStore) ReloadIfChanged() (bool, error) {
+	version, err := s.dirVersion()
+	if err != nil {
+		return false, err
+	}
+	s.lock.RLock()
+	changed := version != s.version
+	s.lock.RUnlock()
+	if !changed {
+		return false, nil
+	}
+	return true, s.Reload()
+}
+
+// 每隔interval检查一次目录，返回停止的函数
+func (s *FileKeyStore) Watch(interval time.Duration) (stop func()) {
+	ch := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ch:
+				return
+			case <-ticker.C:
+				_, err := s.ReloadIfChanged()
+				if err != nil && s.OnError != nil {
+					s.OnError(err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(ch) })
+	}
+}
+
+// 生成alg的新key，同一个算法原来active的私钥变成retired，然后保存
+func (s *FileKeyStore) Rotate(alg Alg) (*StoredKey, error) {
+	key, kid, err := generateKey(alg, s.config)
+	if err != nil {
+		return nil, err
+	}
+	k := new(StoredKey)
+	k.Kid = kid
+	k.Alg = alg
+	k.Status = KeyStatusActive
+	k.NotBefore = s.config.now().UTC()
+	k.Key = key
+	return k, s.update(func(keys []*StoredKey) ([]*StoredKey, error) {
+		for _, o := range keys {
+			if o.Alg == alg && o.Status == KeyStatusActive && !isPublicKey(o.Key) {
+				o.Status = KeyStatusRetired
+				if o.NotAfter.IsZero() || o.NotAfter.After(k.NotBefore) {
+					o.NotAfter = k.NotBefore
+				}
+			}
+		}
+		return append(keys, k), nil
+	})
+}
+
+// 添加已有的key，k.File为空自动生成，
+// 公钥只用于KeyFunc验证其他签发者的token，
+// 多个key一起检查和保存，有一个不能添加就全部不添加
+func (s *FileKeyStore) Add(keys ...*StoredKey) error {
+	for i, k := range keys {
+		if k.Kid == "" || strings.ContainsAny(k.Kid, `/\:`) {
+			return fmt.Errorf("invalid kid <%s>", k.Kid)
+		}
+		for _, o := range keys[:i] {
+			if o.Kid == k.Kid {
+				return fmt.Errorf("duplicate kid <%s>", k.Kid)
+			}
+		}
+	}
+	return s.update(func(old []*StoredKey) ([]*StoredKey, error) {
+		for _, o := range old {
+			for _, k := range keys {
+				if o.Kid == k.Kid {
+					return nil, fmt.Errorf("kid <%s> exists", k.Kid)
+				}
+			}
+		}
+		return append(old, keys...), nil
+	})
+}
+
+// 修改key的状态，然后保存，
+// 退役的key在现在停止签名，grace之后不能验证
+func (s *FileKeyStore) SetStatus(kid string, status KeyStatus) error {
+	now := s.config.now().UTC()
+	return s.update(func(keys []*StoredKey) ([]*StoredKey, error) {
+		for _, k := range keys {
+			if k.Kid == kid {
+				k.Status = status
+				if status == KeyStatusRetired && (k.NotAfter.IsZero() || k.NotAfter.After(now)) {
+					k.NotAfter = now
+				}
+				return keys, nil
+			}
+		}
+		return nil, ErrKeyNotFound
+	})
+}
+
+// 修改key列表，写新的key文件，最后写元数据，成功之后替换内存中的key，
+// 目录被其他实例修改过先重新加载，不会覆盖别人的修改
+func (s *FileKeyStore) update(change func(keys []*StoredKey) ([]*StoredKey, error)) error {
+	s.lock.Lock()
+	current := s.keys
+	version, err := s.dirVersion()
+	if err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	if version != s.version {
+		current, err = s.load()
+		if err != nil {
+			s.lock.Unlock()
+			return err
+		}
+	}
+	// 复制，失败时不影响内存中的key
+	keys := make([]*StoredKey, len(current))
+	for i, k := range current {
+		c := *k
+		keys[i] = &c
+	}
+	keys, err = change(keys)
+	if err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	// 失败时删除这次写的key文件，里面有私钥
+	var written []string
+	fail := func(err error) error {
+		for _, name := range written {
+			_ = os.Remove(filepath.Join(s.dir, name))
+		}
+		s.lock.Unlock()
+		return err
+	}
+	for _, k := range keys {
+		if k.File != "" {
+			continue
+		}
+		err = s.writeKey(k)
+		if err != nil {
+			return fail(err)
+		}
+		written = append(written, k.File)
+	}
+	meta := new(keyStoreMeta)
+	meta.Keys = make([]*KeyMeta, len(keys))
+	for i, k := range keys {
+		meta.Keys[i] = &k.KeyMeta
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(s.dir, KeyStoreMetaFile), data)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	s.keys = keys
+	s.version, _ = s.dirVersion()
+	s.lock.Unlock()
+	return s.apply(keys)
+}
+
+// 写key文件，设置k.File
+func (s *FileKeyStore) writeKey(k *StoredKey) error {
+	var j *JWK
+	var err error
+	if isPublicKey(k.Key) {
+		j, err = NewJWK(k.Key, k.Alg, k.Kid)
+	} else {
+		j, err = NewPrivateJWK(k.Key, k.Alg, k.Kid)
+	}
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	name := k.Kid + ".jwk"
+	if s.master != nil {
+		header := make(Claims)
+		header["cty"] = "jwk+json"
+		token, err := Encrypt(data, header, &Recipient{Alg: A256GCMKWAlg, Enc: A256GCMEnc, Key: s.master}, s.config)
+		if err != nil {
+			return err
+		}
+		data = []byte(token)
+		name = k.Kid + ".jwe"
+	}
+	err = writeFileAtomic(filepath.Join(s.dir, name), data)
+	if err != nil {
+		return err
+	}
+	k.File = name
+	return nil
+}
+
+// 读取元数据和所有的key文件
+func (s *FileKeyStore) load() ([]*StoredKey, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, KeyStoreMetaFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	meta := new(keyStoreMeta)
+	err = json.Unmarshal(data, meta)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*StoredKey, 0, len(meta.Keys))
+	for _, m := range meta.Keys {
+		if m.File != filepath.Base(m.File) {
+			return nil, fmt.Errorf("invalid key file <%s>", m.File)
+		}
+		k := new(StoredKey)
+		k.KeyMeta = *m
+		k.Key, err = s.readKey(m.File)
+		if err != nil {
+			return nil, fmt.Errorf("key <%s>: %s", m.Kid, err.Error())
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// 根据扩展名解析key文件
+func (s *FileKeyStore) readKey(name string) (interface{}, error) {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(name) {
+	case ".pem":
+		return parsePrivateKeyPem(data)
+	case ".jwe":
+		if s.master == nil {
+			return nil, ErrKeyStoreMasterKey
+		}
+		_, data, err = Decrypt(string(data), func(header Claims) (interface{}, error) {
+			if header["alg"] != string(A256GCMKWAlg) {
+				return nil, ErrUnsupportedAlg
+			}
+			return s.master, nil
+		}, s.config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	j := new(JWK)
+	err = json.Unmarshal(data, j)
+	if err != nil {
+		return nil, err
+	}
+	if j.Kty != "oct" && j.D == "" {
+		return j.PublicKey()
+	}
+	return j.PrivateKey()
+}
+
+// 把每个算法最新的active的key设置到Provider
+func (s *FileKeyStore) apply(keys []*StoredKey) error {
+	if s.Provider == nil {
+		return nil
+	}
+	now := s.config.now()
+	active := make(map[Alg]*StoredKey)
+	for _, k := range keys {
+		if k.Status != KeyStatusActive || isPublicKey(k.Key) || now.Before(k.NotBefore) || (!k.NotAfter.IsZero() && !now.Before(k.NotAfter)) {
+			continue
+		}
+		if o, ok := active[k.Alg]; !ok || k.NotBefore.After(o.NotBefore) {
+			active[k.Alg] = k
+		}
+	}
+	algs := make([]string, 0, len(active))
+	for a := range active {
+		algs = append(algs, string(a))
+	}
+	sort.Strings(algs)
+	for _, a := range algs {
+		k := active[Alg(a)]
+		err := s.Provider.setKey(k.Alg, k.Key, k.Kid)
+		if err != nil {
+			return err
+		}
+		s.Provider.SetKeyLifetime(k.Alg, k.lifetime(s.Grace))
+	}
+	// provider还在使用的key不再是active，停止签名，
+	// 吊销的key不能再验证，其他的按照有效期在grace期间还可以验证
+	for _, k := range keys {
+		if active[k.Alg] == k || !s.Provider.hasKey(k.Alg, k.Key) {
+			continue
+		}
+		if k.Status == KeyStatusRevoked {
+			s.Provider.RevokeKey(k.Alg)
+			continue
+		}
+		l := k.lifetime(s.Grace)
+		if k.Status == KeyStatusRetired && l.NotAfter.IsZero() {
+			l.NotAfter = now
+		}
+		s.Provider.SetKeyLifetime(k.Alg, l)
+	}
+	// 退役的key，Verify使用header.kid找到它们
+	retired := make(map[string]*retiredKey)
+	for _, k := range keys {
+		if k.Status != KeyStatusRetired || isPublicKey(k.Key) {
+			continue
+		}
+		l := k.lifetime(s.Grace)
+		if l.CanVerify(now) {
+			retired[k.Kid] = &retiredKey{alg: k.Alg, key: k.Key, lifetime: l}
+		}
+	}
+	s.Provider.setRetiredKeys(retired)
+	return nil
+}
+
+// 实现KeyFunc，使用header.kid找到没有吊销的key，
+// 返回LifetimeKey，验证时iat必须在key的签名时间内
+func (s *FileKeyStore) KeyFunc(header Claims) (interface{}, error) {
+	kid, _ := header["kid"].(string)
+	alg, _ := header["alg"].(string)
+	k := s.Get(kid)
+	if k == nil || k.Status == KeyStatusRevoked {
+		return nil, ErrKeyNotFound
+	}
+	if string(k.Alg) != alg {
+		return nil, ErrUnsupportedAlg
+	}
+	l := k.lifetime(s.Grace)
+	if !l.CanVerify(s.config.now()) {
+		return nil, ErrKeyRetired
+	}
+	return &LifetimeKey{Key: k.Key, Lifetime: l}, nil
+}
+
+// 没有吊销的非对称key的公钥
+func (s *FileKeyStore) JWKS() *JWKSet {
+	set := new(JWKSet)
+	set.Keys = make([]*JWK, 0)
+	for _, k := range s.Keys() {
+		if k.Status == KeyStatusRevoked {
+			continue
+		}
+		j, err := NewJWK(k.Key, k.Alg, k.Kid)
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, j)
+	}
+	return set
+}
+
+// 目录中所有文件的名称，修改时间和大小
+func (s *FileKeyStore) dirVersion() (string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return "", err
+	}
+	var str strings.Builder
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), ".tmp") {
+			continue
+		}
+		fmt.Fprintf(&str, "%s %d %d\n", info.Name(), info.ModTime().UnixNano(), info.Size())
+	}
+	return str.String(), nil
+}
+
+// 是否只有公钥
+func isPublicKey(key interface{}) bool {
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return true
+	}
+	return false
+}
+
+// 生成alg的key，返回key和kid
+func generateKey(alg Alg, config *Config) (interface{}, string, error) {
+	var key interface{}
+	var err error
+	switch alg {
+	case HS256Alg, HS384Alg, HS512Alg:
+		b, err := randomBytes(config.random(), alg.Hash().Size())
+		if err != nil {
+			return nil, "", err
+		}
+		kid, err := newJTI(config.random())
+		if err != nil {
+			return nil, "", err
+		}
+		return b, kid, nil
+	case RS256Alg, RS384Alg, RS512Alg, PS256Alg, PS384Alg, PS512Alg, RSAOAEP256Alg:
+		key, err = rsa.GenerateKey(config.random(), 2048)
+	case ES256Alg:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), config.random())
+	case ES384Alg:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), config.random())
+	case ES512Alg:
+		key, err = ecdsa.GenerateKey(elliptic.P521(), config.random())
+	default:
+		return nil, "", fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	kid, err := JKT(key)
+	if err != nil {
+		return nil, "", err
+	}
+	return key, kid, nil
+}
+
+// 解析pem格式的私钥，pkcs8，pkcs1或者ec
+func parsePrivateKeyPem(data []byte) (interface{}, error) {
+	b, _ := pem.Decode(data)
+	if b == nil {
+		return nil, ErrUnsupportedKey
+	}
+	switch b.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(b.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(b.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(b.Bytes)
+	}
+	return nil, fmt.Errorf("unsupported pem type <%s>", b.Type)
+}
+
+// 先写临时文件，然后改名
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	err := ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,398 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试文件keystore的保存，重启加载，轮换和吊销
+func Test_FileKeyStore(t *testing.T) {
+	dir := t.TempDir()
+	master := make([]byte, 32)
+	store, err := NewFileKeyStore(dir, master, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Provider = NewDefaultProvider("", "", "")
+	k1, err := store.Rotate(ES256Alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Rotate(HS256Alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(k1.File, ".jwe") || store.Provider.KeyID(ES256Alg) != k1.Kid {
+		t.Fatal(k1.File)
+	}
+	token1, _ := Sign(ES256Alg, make(Claims), make(Claims), store.Provider)
+	token2, _ := Sign(HS256Alg, make(Claims), make(Claims), store.Provider)
+	// 重启
+	_, err = NewFileKeyStore(dir, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), ErrKeyStoreMasterKey.Error()) {
+		t.Fatal(err)
+	}
+	other, err := NewFileKeyStore(dir, master, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pro := NewDefaultProvider("", "", "")
+	other.Provider = pro
+	err = other.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{token1, token2} {
+		_, _, err = Verify(token, pro)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 轮换之后旧的key还可以验证
+	k2, _ := other.Rotate(ES256Alg)
+	if other.Get(k1.Kid).Status != KeyStatusRetired || pro.KeyID(ES256Alg) != k2.Kid {
+		t.FailNow()
+	}
+	_, _, err = VerifyWithKeyFunc(token1, other.KeyFunc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 另一个实例发现文件变化
+	changed, err := store.ReloadIfChanged()
+	if err != nil || !changed || store.Provider.KeyID(ES256Alg) != k2.Kid {
+		t.Fatal(changed, err)
+	}
+	changed, _ = store.ReloadIfChanged()
+	if changed {
+		t.FailNow()
+	}
+	// 吊销
+	err = store.SetStatus(k1.Kid, KeyStatusRevoked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = VerifyWithKeyFunc(token1, store.KeyFunc, nil)
+	if err != ErrKeyNotFound {
+		t.Fatal(err)
+	}
+	// 直接放到目录中的pem
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	_ = ioutil.WriteFile(filepath.Join(dir, "ops.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	data, _ := ioutil.ReadFile(filepath.Join(dir, KeyStoreMetaFile))
+	var meta keyStoreMeta
+	_ = json.Unmarshal(data, &meta)
+	meta.Keys = append(meta.Keys, &KeyMeta{Kid: "ops", Alg: ES384Alg, Status: KeyStatusActive, NotBefore: time.Now().Add(-time.Second), File: "ops.pem"})
+	data, _ = json.Marshal(&meta)
+	_ = ioutil.WriteFile(filepath.Join(dir, KeyStoreMetaFile), data, 0600)
+	stop := store.Watch(10 * time.Millisecond)
+	defer stop()
+	for i := 0; store.Get("ops") == nil; i++ {
+		if i > 100 {
+			t.Fatal("not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	token, _ := SignWithKey(ES384Alg, Claims{"kid": "ops"}, make(Claims), key, nil)
+	_, _, err = VerifyWithKeyFunc(token, store.KeyFunc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 测试多个实例修改同一个目录，hs的kid，以及签名验证的同时轮换
+func Test_FileKeyStoreConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileKeyStore(dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Provider = NewDefaultProvider("", "", "")
+	other, err := NewFileKeyStore(dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// other没有重新加载，修改时不能覆盖store的key
+	k1, _ := store.Rotate(ES256Alg)
+	k2, err := other.Rotate(HS256Alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = other.SetStatus(k1.Kid, KeyStatusRetired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.ReloadIfChanged()
+	if err != nil || len(store.Keys()) != 2 || store.Get(k1.Kid).Status != KeyStatusRetired || store.Get(k2.Kid) == nil {
+		t.Fatal(err, store.Keys())
+	}
+	// provider签名的hs token带有keystore的kid
+	k3, _ := store.Rotate(HS256Alg)
+	token, _ := Sign(HS256Alg, make(Claims), make(Claims), store.Provider)
+	header, _, err := VerifyWithKeyFunc(token, store.KeyFunc, nil)
+	if err != nil || header["kid"] != k3.Kid {
+		t.Fatal(header, err)
+	}
+	_, _, err = Verify(token, store.Provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 签名验证的同时轮换，使用go test -race
+	store.Rotate(ES256Alg)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			_, err := store.Rotate(ES256Alg)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		token, err := Sign(ES256Alg, make(Claims), make(Claims), store.Provider)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = VerifyWithKeyFunc(token, store.KeyFunc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, _ = Verify(token, store.Provider)
+		_ = store.Provider.JWKS()
+	}
+}
+
+// 测试退役的key在grace期间使用kid验证，iat必须在key的签名时间内
+func Test_FileKeyStoreGrace(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	config := &Config{Clock: ClockFunc(func() time.Time { return now })}
+	store, err := NewFileKeyStore(t.TempDir(), nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Provider = NewDefaultProviderWithConfig(config, "", "", "")
+	k1, _ := store.Rotate(ES256Alg)
+	token, _ := Sign(ES256Alg, make(Claims), make(Claims), store.Provider)
+	now = now.Add(time.Hour)
+	_, _ = store.Rotate(ES256Alg)
+	// provider只有新的key，使用kid找到退役的key
+	_, _, err = Verify(token, store.Provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 退役之后签发的token
+	forged, _ := SignWithKey(ES256Alg, Claims{"kid": k1.Kid}, Claims{"iat": now.Add(48 * time.Hour).Unix()}, k1.Key, config)
+	_, _, err = Verify(forged, store.Provider)
+	if err != ErrKeyLifetime {
+		t.Fatal(err)
+	}
+	_, _, err = VerifyWithKeyFunc(forged, store.KeyFunc, config)
+	if err != ErrKeyLifetime {
+		t.Fatal(err)
+	}
+	// 没有iat的token，只在key还可以签名的时候接受
+	noIAT := func(k *StoredKey) string {
+		data := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"`+k.Kid+`"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{}`))
+		m := hmac.New(sha256.New, k.Key.([]byte))
+		m.Write([]byte(data))
+		return data + "." + base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+	}
+	k3, _ := store.Rotate(HS256Alg)
+	_, _, err = VerifyWithKeyFunc(noIAT(k3), store.KeyFunc, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SetStatus(k3.Kid, KeyStatusRetired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = VerifyWithKeyFunc(noIAT(k3), store.KeyFunc, config)
+	if err != ErrKeyLifetime {
+		t.Fatal(err)
+	}
+	// grace之后
+	now = now.Add(store.Grace)
+	_, _, err = Verify(token, store.Provider)
+	if err != ErrKeyRetired {
+		t.Fatal(err)
+	}
+}
+
+// 测试算法唯一的active key退役之后provider停止签名，grace期间还可以验证
+func Test_FileKeyStoreRetireActive(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	config := &Config{Clock: ClockFunc(func() time.Time { return now })}
+	store, err := NewFileKeyStore(t.TempDir(), nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Provider = NewDefaultProviderWithConfig(config, "", "", "")
+	k, _ := store.Rotate(ES256Alg)
+	token, _ := Sign(ES256Alg, make(Claims), make(Claims), store.Provider)
+	now = now.Add(time.Minute)
+	err = store.SetStatus(k.Kid, KeyStatusRetired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Sign(ES256Alg, make(Claims), make(Claims), store.Provider)
+	if err != ErrKeyExpired {
+		t.Fatal(err)
+	}
+	_, _, err = Verify(token, store.Provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// grace之后
+	now = now.Add(store.Grace)
+	_, _, err = Verify(token, store.Provider)
+	if err != ErrKeyRetired {
+		t.Fatal(err)
+	}
+}
+
+// 测试元数据写失败时删除这次写的key文件
+func Test_FileKeyStoreWriteFail(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileKeyStore(dir, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 临时文件的位置是目录，写元数据失败
+	err = os.Mkdir(filepath.Join(dir, KeyStoreMetaFile+".tmp"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Rotate(ES256Alg)
+	if err == nil {
+		t.FailNow()
+	}
+	infos, _ := ioutil.ReadDir(dir)
+	if len(infos) != 1 || len(store.Keys()) != 0 {
+		t.Fatal(infos)
+	}
+	_ = os.Remove(filepath.Join(dir, KeyStoreMetaFile+".tmp"))
+	_, err = store.Rotate(ES256Alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 测试key管理接口的授权，轮换，导入和吊销
+func Test_KeyAdminHandler(t *testing.T) {
+	store, err := NewFileKeyStore(t.TempDir(), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Provider = NewDefaultProvider("", "", "")
+	var events []*KeyAuditEvent
+	h := NewKeyAdminHandler(store, func(r *http.Request, action string) (string, error) {
+		if r.Header.Get("Authorization") != "Bearer admin" {
+			return "", ErrForbidden
+		}
+		return "admin", nil
+	})
+	h.Audit = func(e *KeyAuditEvent) {
+		events = append(events, e)
+	}
+	do := func(method, path, auth string, body io.Reader, v interface{}) int {
+		r := httptest.NewRequest(method, path, body)
+		if method == http.MethodPost && path != KeyAdminJWKSPath {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		r.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if v != nil {
+			_ = json.Unmarshal(w.Body.Bytes(), v)
+		}
+		return w.Code
+	}
+	// 没有授权
+	if do(http.MethodPost, KeyAdminRotatePath, "", strings.NewReader("alg=ES256"), nil) != http.StatusForbidden ||
+		len(events) != 1 || events[0].Error == "" {
+		t.FailNow()
+	}
+	var info keyAdminInfo
+	if do(http.MethodPost, KeyAdminRotatePath, "Bearer admin", strings.NewReader("alg=ES256"), &info) != http.StatusOK ||
+		info.Status != KeyStatusActive || events[1].Kid != info.Kid || events[1].Actor != "admin" {
+		t.Fatal(info)
+	}
+	token, err := Sign(ES256Alg, make(Claims), make(Claims), store.Provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 导出之后导入另一个签发者的公钥
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	j, _ := NewJWK(key, ES256Alg, "partner")
+	var set JWKSet
+	if do(http.MethodGet, KeyAdminJWKSPath, "Bearer admin", nil, &set) != http.StatusOK || set.Find(info.Kid, "") == nil {
+		t.FailNow()
+	}
+	data, _ := json.Marshal(&JWKSet{Keys: []*JWK{j}})
+	if do(http.MethodPost, KeyAdminJWKSPath, "Bearer admin", bytes.NewReader(data), nil) != http.StatusOK {
+		t.FailNow()
+	}
+	partner, _ := SignWithKey(ES256Alg, Claims{"kid": "partner"}, make(Claims), key, nil)
+	_, _, err = VerifyWithKeyFunc(partner, store.KeyFunc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// kty和alg不一致，或者其中有一个key不能导入，一个都不导入
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	mismatch, _ := NewJWK(&rk.PublicKey, RS256Alg, "rsa")
+	mismatch.Alg = string(ES256Alg)
+	good, _ := NewJWK(&rk.PublicKey, RS256Alg, "good")
+	for _, keys := range [][]*JWK{{mismatch}, {good, mismatch}, {good, j}} {
+		data, _ = json.Marshal(&JWKSet{Keys: keys})
+		if do(http.MethodPost, KeyAdminJWKSPath, "Bearer admin", bytes.NewReader(data), nil) != http.StatusBadRequest {
+			t.Fatal(keys)
+		}
+		if store.Get("good") != nil || store.Get("rsa") != nil {
+			t.Fatal(keys)
+		}
+	}
+	var list []*keyAdminInfo
+	if do(http.MethodGet, KeyAdminKeysPath, "Bearer admin", nil, &list) != http.StatusOK || len(list) != 2 || !list[1].Public {
+		t.FailNow()
+	}
+	// 吊销之后马上不能验证
+	if do(http.MethodPost, KeyAdminRevokePath, "Bearer admin", strings.NewReader("kid="+info.Kid), nil) != http.StatusOK {
+		t.FailNow()
+	}
+	_, _, err = Verify(token, store.Provider)
+	if err != ErrKeyRevoked {
+		t.Fatal(err)
+	}
+	_, err = Sign(ES256Alg, make(Claims), make(Claims), store.Provider)
+	if err != ErrKeyRevoked {
+		t.Fatal(err)
+	}
+	if len(events) != 8 || events[5].Error == "" || events[6].Error == "" || events[7].Action != KeyAdminRevoke || events[7].Alg != ES256Alg {
+		t.Fatal(len(events))
+	}
+}
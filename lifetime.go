@@ -0,0 +1,97 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrKeyExpired  = errors.New("signing key expired")
+	ErrKeyRetired  = errors.New("key retired")
+	ErrKeyRevoked  = errors.New("key revoked")
+	ErrKeyLifetime = errors.New("token issued outside key lifetime")
+)
+
+// key的有效期
+type KeyLifetime struct {
+	NotBefore time.Time     // 开始签名的时间
+	NotAfter  time.Time     // 停止签名的时间，零值表示不过期
+	Grace     time.Duration // 停止签名之后还可以验证的时间
+	Revoked   bool          // 吊销之后不能签名和验证
+}
+
+// now是否可以签名
+func (l *KeyLifetime) CanSign(now time.Time) bool {
+	if l.Revoked || now.Before(l.NotBefore) {
+		return false
+	}
+	return l.NotAfter.IsZero() || now.Before(l.NotAfter)
+}
+
+// now是否可以验证
+func (l *KeyLifetime) CanVerify(now time.Time) bool {
+	if l.Revoked || now.Before(l.NotBefore) {
+		return false
+	}
+	return l.NotAfter.IsZero() || now.Before(l.NotAfter.Add(l.Grace))
+}
+
+// key必须还可以验证，有iat的时候必须在key的签名时间内，
+// 没有iat无法知道签发时间，只在key还可以签名的时候接受，grace期间拒绝
+func (l *KeyLifetime) validate(payload Claims, c *Config) error {
+	now := c.now()
+	if l.Revoked {
+		return ErrKeyRevoked
+	}
+	if !l.CanVerify(now) {
+		return ErrKeyRetired
+	}
+	if _, ok := payload["iat"]; !ok {
+		if !l.CanSign(now) {
+			return ErrKeyLifetime
+		}
+		return nil
+	}
+	iat, ok := claimInt64(payload, "iat")
+	if !ok {
+		return ErrKeyLifetime
+	}
+	t := time.Unix(iat, 0)
+	if t.Add(c.Leeway).Before(l.NotBefore.Truncate(time.Second)) {
+		return ErrKeyLifetime
+	}
+	if !l.NotAfter.IsZero() && t.Add(-c.Leeway).After(l.NotAfter) {
+		return ErrKeyLifetime
+	}
+	return nil
+}
+
+// 签名之前的检查
+func (l *KeyLifetime) checkSign(now time.Time) error {
+	if l.Revoked {
+		return ErrKeyRevoked
+	}
+	if !l.CanSign(now) {
+		return ErrKeyExpired
+	}
+	return nil
+}
+
+// KeyFunc可以返回它，验证签名之后还会使用Lifetime检查payload的iat
+type LifetimeKey struct {
+	Key      interface{}
+	Lifetime *KeyLifetime
+}
+
+// provider可以实现这个接口，签名和验证时检查key的有效期
+type KeyLifetimeProvider interface {
+	KeyLifetime(alg Alg) *KeyLifetime
+}
+
+// 没有返回nil
+func keyLifetimeOf(provider Provider, alg Alg) *KeyLifetime {
+	if p, ok := provider.(KeyLifetimeProvider); ok {
+		return p.KeyLifetime(alg)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package jwt
+
+import "strings"
+
+// provider可以实现这个接口，提供jwe的解密key，和签名的key分开管理
+type DecryptionKeyProvider interface {
+	DecryptionKey(header Claims) (interface{}, error)
+}
+
+// 嵌套jwt，先使用provider签名，然后加密给recipient，外层header.cty是"JWT"
+func SignAndEncrypt(alg Alg, header, payload Claims, provider Provider, recipient *Recipient) (string, error) {
+	token, err := Sign(alg, header, payload, provider)
+	if err != nil {
+		return "", err
+	}
+	outer := make(Claims)
+	outer["cty"] = "JWT"
+	return Encrypt([]byte(token), outer, recipient, configOf(provider))
+}
+
+// 使用recipient的key解密，然后使用issuer验证里面的jws，返回jws的header和payload
+func DecryptAndVerify(token string, recipient DecryptionKeyProvider, issuer Provider) (header, payload Claims, err error) {
+	inner, err := decryptNested(token, recipient.DecryptionKey, configOf(issuer))
+	if err != nil {
+		return nil, nil, err
+	}
+	return Verify(inner, issuer)
+}
+
+// 和DecryptAndVerify一样，使用keyFunc提供key
+func DecryptAndVerifyWithKeyFunc(token string, decryptKey, verifyKey KeyFunc, config *Config) (header, payload Claims, err error) {
+	inner, err := decryptNested(token, decryptKey, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return VerifyWithKeyFunc(inner, verifyKey, config)
+}
+
+// 解密，返回里面的jws
+func decryptNested(token string, keyFunc KeyFunc, config *Config) (string, error) {
+	header, plaintext, err := Decrypt(token, keyFunc, config)
+	if err != nil {
+		return "", err
+	}
+	cty, _ := header["cty"].(string)
+	if !strings.EqualFold(cty, "JWT") {
+		return "", ErrInvalidTokenType
+	}
+	return string(plaintext), nil
+}
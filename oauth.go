@@ -0,0 +1,273 @@
+package jwt
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// private_key_jwt的client_assertion_type
+	ClientAssertionJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+var (
+	ErrInvalidClient = errors.New("invalid client")
+)
+
+// 注册的客户端
+type Client struct {
+	ID     string   `json:"client_id"`
+	Secret string   `json:"client_secret,omitempty"` // client_secret_basic和client_secret_post
+	JWKS   *JWKSet  `json:"jwks,omitempty"`          // private_key_jwt
+	Scopes []string `json:"scopes,omitempty"`        // 允许的scope
+}
+
+// 从json文件加载客户端，格式是{"clients":[...]}
+func LoadClients(path string) (*ClientRegistry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Clients []*Client `json:"clients"`
+	}
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientRegistry(file.Clients...), nil
+}
+
+func NewClientRegistry(clients ...*Client) *ClientRegistry {
+	r := new(ClientRegistry)
+	r.clients = make(map[string]*Client)
+	for _, c := range clients {
+		r.clients[c.ID] = c
+	}
+	return r
+}
+
+// 客户端注册表，也负责客户端认证
+type ClientRegistry struct {
+	Audience []string     // private_key_jwt的aud必须包含其中一个，一般是token endpoint的url
+	Replay   ConsumeStore // 不为nil，private_key_jwt的jti只能使用一次
+	Config   *Config      // 验证private_key_jwt，nil使用DefaultConfig
+	clients  map[string]*Client
+}
+
+func (r *ClientRegistry) Get(id string) *Client {
+	return r.clients[id]
+}
+
+// 认证请求的客户端，支持client_secret_basic，client_secret_post和private_key_jwt
+func (r *ClientRegistry) Authenticate(req *http.Request) (*Client, error) {
+	err := req.ParseForm()
+	if err != nil {
+		return nil, err
+	}
+	// private_key_jwt
+	if t := req.PostForm.Get("client_assertion_type"); t != "" {
+		if t != ClientAssertionJWTBearer {
+			return nil, ErrInvalidClient
+		}
+		return r.authenticateAssertion(req.PostForm.Get("client_assertion"), req.PostForm.Get("client_id"))
+	}
+	// client_secret_basic
+	id, secret, ok := req.BasicAuth()
+	if ok {
+		id, err = url.QueryUnescape(id)
+		if err != nil {
+			return nil, ErrInvalidClient
+		}
+		secret, err = url.QueryUnescape(secret)
+		if err != nil {
+			return nil, ErrInvalidClient
+		}
+	} else {
+		// client_secret_post
+		id = req.PostForm.Get("client_id")
+		secret = req.PostForm.Get("client_secret")
+	}
+	c := r.clients[id]
+	if c == nil || c.Secret == "" || secret == "" {
+		return nil, ErrInvalidClient
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Secret), []byte(secret)) != 1 {
+		return nil, ErrInvalidClient
+	}
+	return c, nil
+}
+
+// rfc7523，iss和sub是client_id，使用客户端的jwks验证
+func (r *ClientRegistry) authenticateAssertion(assertion, id string) (*Client, error) {
+	_, payload, _, err := parseUnverified(assertion)
+	if err != nil {
+		return nil, ErrInvalidClient
+	}
+	sub, _ := payload["sub"].(string)
+	if id != "" && id != sub {
+		return nil, ErrInvalidClient
+	}
+	c := r.clients[sub]
+	if c == nil || c.JWKS == nil {
+		return nil, ErrInvalidClient
+	}
+	_, payload, err = VerifyWithKeyFunc(assertion, c.JWKS.KeyFunc, r.Config)
+	if err != nil {
+		return nil, ErrInvalidClient
+	}
+	if payload["iss"] != c.ID || payload["sub"] != c.ID {
+		return nil, ErrInvalidClient
+	}
+	// aud
+	ok := false
+	for _, a := range claimStrings(payload, "aud") {
+		if containsString(r.Audience, a) {
+			ok = true
+			break
+		}
+	}
+	if !ok {
+		return nil, ErrInvalidClient
+	}
+	// exp必须有
+	if _, ok = claimInt64(payload, "exp"); !ok {
+		return nil, ErrInvalidClient
+	}
+	// jti重放
+	if r.Replay != nil {
+		jti, _ := payload["jti"].(string)
+		if jti == "" {
+			return nil, ErrInvalidClient
+		}
+		config := r.Config
+		if config == nil {
+			config = DefaultConfig
+		}
+		// 在exp加上Leeway之前验证都会通过，记录要保存到这个时间
+		ok, err = r.Replay.Consume(c.ID+" "+jti, payloadExpiry(payload, config))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrInvalidClient
+		}
+	}
+	return c, nil
+}
+
+// rfc6749的错误响应
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+	}
+	writeJSON(w, status, &OAuthError{Code: code, Description: description})
+}
+
+// token endpoint的成功响应
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+func NewTokenHandler(issuer string, clients *ClientRegistry, provider Provider, alg Alg) *TokenHandler {
+	h := new(TokenHandler)
+	h.Issuer = issuer
+	h.Clients = clients
+	h.Provider = provider
+	h.Alg = alg
+	h.TTL = time.Hour
+	return h
+}
+
+// rfc6749 client_credentials的token endpoint
+type TokenHandler struct {
+	Issuer   string          // access token的iss
+	Audience []string        // access token的aud，空使用Issuer
+	Clients  *ClientRegistry // 客户端
+	Provider Provider        // 签名
+	Alg      Alg             // 签名算法
+	TTL      time.Duration   // access token有效期
+}
+
+func (h *TokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeOAuthError(w, http.StatusMethodNotAllowed, "invalid_request", "method must be POST")
+		return
+	}
+	c, err := h.Clients.Authenticate(r)
+	if err != nil {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	if g := r.PostForm.Get("grant_type"); g != "client_credentials" {
+		if g == "" {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "missing grant_type")
+		} else {
+			writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		}
+		return
+	}
+	// 请求的scope必须都在允许的范围，没有请求使用所有允许的
+	scope := c.Scopes
+	if s := r.PostForm.Get("scope"); s != "" {
+		scope = strings.Fields(s)
+		for _, v := range scope {
+			if !containsString(c.Scopes, v) {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_scope", v)
+				return
+			}
+		}
+	}
+	token, err := h.issue(c, scope)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	w.Header().Set("Pragma", "no-cache")
+	writeJSON(w, http.StatusOK, &TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(h.TTL / time.Second),
+		Scope:       strings.Join(scope, " "),
+	})
+}
+
+// 签发rfc9068 access token
+func (h *TokenHandler) issue(c *Client, scope []string) (string, error) {
+	payload := NewPayload()
+	payload.SetISS(h.Issuer)
+	payload.SetSUB(c.ID)
+	if len(h.Audience) > 0 {
+		payload.SetAUD(h.Audience...)
+	} else {
+		payload.SetAUD(h.Issuer)
+	}
+	payload.SetEXPAt(configOf(h.Provider).now().Add(h.TTL))
+	payload["client_id"] = c.ID
+	if len(scope) > 0 {
+		payload["scope"] = strings.Join(scope, " ")
+	}
+	return SignAccessToken(h.Alg, make(Claims), Claims(payload), h.Provider)
+}
@@ -0,0 +1,292 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试用的token endpoint，返回服务器和private_key_jwt客户端的私钥
+func newTestTokenServer(t *testing.T, pro Provider) (*httptest.Server, *TokenHandler, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk, _ := NewJWK(&key.PublicKey, ES256Alg, "k1")
+	data, _ := json.Marshal(map[string]interface{}{
+		"clients": []*Client{
+			{ID: "secret", Secret: "s3cret", Scopes: []string{"read", "write"}},
+			{ID: "jwt", JWKS: &JWKSet{Keys: []*JWK{jwk}}, Scopes: []string{"read"}},
+		},
+	})
+	path := filepath.Join(t.TempDir(), "clients.json")
+	err := ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients, err := LoadClients(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients.Replay = NewMemoryRevocationStore(nil)
+	handler := NewTokenHandler("https://issuer", clients, pro, RS256Alg)
+	server := httptest.NewServer(handler)
+	clients.Audience = []string{server.URL}
+	return server, handler, key
+}
+
+func postForm(t *testing.T, url string, form url.Values, id, secret string) (int, map[string]interface{}) {
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if id != "" {
+		req.SetBasicAuth(id, secret)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	m := make(map[string]interface{})
+	_ = json.NewDecoder(res.Body).Decode(&m)
+	return res.StatusCode, m
+}
+
+// 测试client_credentials
+func Test_TokenHandler(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	server, _, key := newTestTokenServer(t, pro)
+	defer server.Close()
+	// client_secret_basic
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {"read"}}
+	status, res := postForm(t, server.URL, form, "secret", "s3cret")
+	if status != http.StatusOK || res["token_type"] != "Bearer" || res["scope"] != "read" {
+		t.Fatal(status, res)
+	}
+	_, p, err := Verify(res["access_token"].(string), pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p["client_id"] != "secret" || p["scope"] != "read" {
+		t.FailNow()
+	}
+	// 密码错误
+	status, res = postForm(t, server.URL, form, "secret", "x")
+	if status != http.StatusUnauthorized || res["error"] != "invalid_client" {
+		t.Fatal(status, res)
+	}
+	// private_key_jwt
+	assertion := func() string {
+		payload := NewPayload()
+		payload.SetISS("jwt")
+		payload.SetSUB("jwt")
+		payload.SetAUD(server.URL)
+		payload.SetEXP(time.Minute)
+		header := NewHeader()
+		header.SetKID("k1")
+		token, err := SignWithKey(ES256Alg, Claims(header), Claims(payload), key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	a := assertion()
+	form = url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {ClientAssertionJWTBearer},
+		"client_assertion":      {a},
+	}
+	status, res = postForm(t, server.URL, form, "", "")
+	if status != http.StatusOK || res["scope"] != "read" {
+		t.Fatal(status, res)
+	}
+	// assertion重放
+	status, _ = postForm(t, server.URL, form, "", "")
+	if status != http.StatusUnauthorized {
+		t.Fatal(status)
+	}
+	// scope不允许
+	form.Set("client_assertion", assertion())
+	form.Set("scope", "write")
+	status, res = postForm(t, server.URL, form, "", "")
+	if status != http.StatusBadRequest || res["error"] != "invalid_scope" {
+		t.Fatal(status, res)
+	}
+}
+
+// 测试introspection和revocation
+func Test_IntrospectionAndRevocation(t *testing.T) {
+	config := &Config{Revocation: NewMemoryRevocationStore(nil)}
+	pro := NewDefaultProviderWithConfig(config, "hs256", "hs384", "hs512")
+	server, handler, _ := newTestTokenServer(t, pro)
+	defer server.Close()
+	introspect := httptest.NewServer(NewIntrospectionHandler(handler.Clients, pro))
+	defer introspect.Close()
+	revoke := httptest.NewServer(NewRevocationHandler(handler.Clients, pro, nil))
+	defer revoke.Close()
+	form := url.Values{"grant_type": {"client_credentials"}}
+	_, res := postForm(t, server.URL, form, "secret", "s3cret")
+	token, _ := res["access_token"].(string)
+	form = url.Values{"token": {token}}
+	// 没有认证
+	status, _ := postForm(t, introspect.URL, form, "", "")
+	if status != http.StatusUnauthorized {
+		t.Fatal(status)
+	}
+	status, res = postForm(t, introspect.URL, form, "secret", "s3cret")
+	if status != http.StatusOK || res["active"] != true || res["client_id"] != "secret" {
+		t.Fatal(status, res)
+	}
+	// 别的客户端不能吊销
+	handler.Clients.clients["other"] = &Client{ID: "other", Secret: "o"}
+	status, _ = postForm(t, revoke.URL, form, "other", "o")
+	if status != http.StatusBadRequest {
+		t.Fatal(status)
+	}
+	// 没有client_id的token不能吊销
+	other, _ := Sign(HS256Alg, make(Claims), Claims{"sub": "x"}, pro)
+	status, _ = postForm(t, revoke.URL, url.Values{"token": {other}}, "secret", "s3cret")
+	if status != http.StatusBadRequest {
+		t.Fatal(status)
+	}
+	// 没有有效的jti
+	other, _ = Sign(HS256Alg, make(Claims), Claims{"client_id": "secret", "jti": 1}, pro)
+	status, res = postForm(t, revoke.URL, url.Values{"token": {other}}, "secret", "s3cret")
+	if status != http.StatusBadRequest || res["error"] != "invalid_request" {
+		t.Fatal(status, res)
+	}
+	status, _ = postForm(t, revoke.URL, form, "secret", "s3cret")
+	if status != http.StatusOK {
+		t.Fatal(status)
+	}
+	status, res = postForm(t, introspect.URL, form, "secret", "s3cret")
+	if status != http.StatusOK || res["active"] != false || len(res) != 1 {
+		t.Fatal(status, res)
+	}
+	_, _, err := Verify(token, pro)
+	if err != ErrTokenRevoked {
+		t.Fatal(err)
+	}
+}
+
+// 测试at+jwt
+func Test_AccessTokenValidator(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	v := &AccessTokenValidator{Provider: pro, Issuer: "https://issuer", Audience: "api"}
+	payload := NewPayload()
+	payload.SetISS("https://issuer")
+	payload.SetSUB("user")
+	payload.SetAUD("api")
+	payload.SetEXP(time.Hour)
+	// 缺少client_id
+	_, err := SignAccessToken(ES256Alg, make(Claims), Claims(payload), pro)
+	if err == nil {
+		t.FailNow()
+	}
+	payload["client_id"] = "client"
+	token, err := SignAccessToken(ES256Alg, make(Claims), Claims(payload), pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _, err := v.Validate(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h["typ"] != AccessTokenTyp || h["jwt"] != nil {
+		t.FailNow()
+	}
+	// id token不能当作access token
+	token, err = Sign(ES256Alg, make(Claims), Claims(payload), pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = v.Validate(token)
+	if err != ErrInvalidTokenType {
+		t.Fatal(err)
+	}
+}
+
+// 测试dpop
+func Test_DPoP(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk, _ := NewJWK(&key.PublicKey, "", "")
+	jkt, _ := jwk.Thumbprint(crypto.SHA256)
+	payload := NewPayload()
+	payload.SetEXP(time.Hour)
+	payload["cnf"] = map[string]interface{}{"jkt": jkt}
+	token, _ := Sign(RS256Alg, make(Claims), Claims(payload), pro)
+	v := NewDPoPVerifier(NewMemoryRevocationStore(nil))
+	verify := func(token string) (Claims, error) {
+		_, p, err := Verify(token, pro)
+		return p, err
+	}
+	server := httptest.NewServer(v.Middleware(verify, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ClaimsFromContext(r.Context())["cnf"] == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})))
+	defer server.Close()
+	do := func(key *ecdsa.PrivateKey, proof string) int {
+		if proof == "" {
+			proof, _ = NewDPoPProof(ES256Alg, key, http.MethodGet, server.URL+"/api?x=1", token, nil)
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/api?x=1", nil)
+		req.Header.Set("Authorization", "DPoP "+token)
+		req.Header.Set("DPoP", proof)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	proof, _ := NewDPoPProof(ES256Alg, key, http.MethodGet, server.URL+"/api", token, nil)
+	if status := do(key, proof); status != http.StatusOK {
+		t.Fatal(status)
+	}
+	// 重放
+	if status := do(key, proof); status != http.StatusUnauthorized {
+		t.Fatal(status)
+	}
+	// 别的key
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if status := do(other, ""); status != http.StatusUnauthorized {
+		t.Fatal(status)
+	}
+	// 方法不对
+	proof, _ = NewDPoPProof(ES256Alg, key, http.MethodPost, server.URL+"/api", token, nil)
+	if status := do(key, proof); status != http.StatusUnauthorized {
+		t.Fatal(status)
+	}
+}
+
+// 测试private_key_jwt在exp之后Leeway之内也不能重放
+func Test_ClientAssertionLeeway(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	clock := ClockFunc(func() time.Time { return now })
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk, _ := NewJWK(&key.PublicKey, ES256Alg, "k1")
+	clients := NewClientRegistry(&Client{ID: "jwt", JWKS: &JWKSet{Keys: []*JWK{jwk}}})
+	clients.Audience = []string{"https://token"}
+	clients.Config = &Config{Clock: clock, Leeway: time.Minute}
+	clients.Replay = NewMemoryRevocationStore(clock)
+	payload := Claims{"iss": "jwt", "sub": "jwt", "aud": "https://token", "exp": now.Add(time.Second).Unix()}
+	assertion, _ := SignWithKey(ES256Alg, Claims{"kid": "k1"}, payload, key, clients.Config)
+	_, err := clients.authenticateAssertion(assertion, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	clients.Replay.(*MemoryRevocationStore).Compact()
+	_, err = clients.authenticateAssertion(assertion, "")
+	if err != ErrInvalidClient {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,268 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// rfc6960 ocsp，只实现了验证需要的部分
+
+var (
+	ErrInvalidOCSPResponse = errors.New("invalid ocsp response")
+)
+
+// 证书状态
+const (
+	ocspGood = iota
+	ocspRevoked
+	ocspUnknown
+)
+
+var (
+	oidSHA1              = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+)
+
+// 签名算法oid
+var ocspSignatureAlgorithms = []struct {
+	oid asn1.ObjectIdentifier
+	alg x509.SignatureAlgorithm
+}{
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, x509.SHA1WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, x509.SHA256WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, x509.SHA384WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, x509.SHA512WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, x509.ECDSAWithSHA1},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, x509.ECDSAWithSHA256},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, x509.ECDSAWithSHA384},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, x509.ECDSAWithSHA512},
+	{asn1.ObjectIdentifier{1, 3, 101, 112}, x509.PureEd25519},
+}
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequestItem struct {
+	Cert ocspCertID
+}
+
+type ocspTBSRequest struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	RequestList []ocspRequestItem
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID           ocspCertID
+	Good             asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked          ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown          asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate       time.Time        `asn1:"generalized"`
+	NextUpdate       time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	SingleExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// ocsp的查询结果
+type ocspResult struct {
+	status     int       // ocspGood，ocspRevoked，ocspUnknown
+	nextUpdate time.Time // 缓存的过期时间
+}
+
+// 证书的CertID，使用sha1
+func newOCSPCertID(cert, issuer *x509.Certificate) (*ocspCertID, error) {
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	_, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki)
+	if err != nil {
+		return nil, err
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+	id := new(ocspCertID)
+	id.HashAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue}
+	id.NameHash = nameHash[:]
+	id.IssuerKeyHash = keyHash[:]
+	id.SerialNumber = cert.SerialNumber
+	return id, nil
+}
+
+func (id *ocspCertID) equal(o *ocspCertID) bool {
+	return id.HashAlgorithm.Algorithm.Equal(o.HashAlgorithm.Algorithm) &&
+		bytes.Equal(id.NameHash, o.NameHash) &&
+		bytes.Equal(id.IssuerKeyHash, o.IssuerKeyHash) &&
+		id.SerialNumber.Cmp(o.SerialNumber) == 0
+}
+
+// 缓存的key
+func (id *ocspCertID) key() string {
+	return fmt.Sprintf("%x:%s", id.IssuerKeyHash, id.SerialNumber.String())
+}
+
+// 向cert.OCSPServer查询证书状态
+func queryOCSP(client *http.Client, cert, issuer *x509.Certificate, now time.Time) (*ocspResult, error) {
+	if len(cert.OCSPServer) < 1 {
+		return nil, fmt.Errorf("certificate <%s> has no ocsp server", cert.Subject.CommonName)
+	}
+	id, err := newOCSPCertID(cert, issuer)
+	if err != nil {
+		return nil, err
+	}
+	req, err := asn1.Marshal(ocspRequest{TBSRequest: ocspTBSRequest{RequestList: []ocspRequestItem{{Cert: *id}}}})
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Post(cert.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ocsp <%s> status <%d>", cert.OCSPServer[0], res.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseOCSPResponse(data, id, issuer, now)
+}
+
+// 解析响应，验证签名，找到id的状态
+func parseOCSPResponse(data []byte, id *ocspCertID, issuer *x509.Certificate, now time.Time) (*ocspResult, error) {
+	var res ocspResponse
+	rest, err := asn1.Unmarshal(data, &res)
+	if err != nil || len(rest) > 0 {
+		return nil, ErrInvalidOCSPResponse
+	}
+	if res.Status != 0 {
+		return nil, fmt.Errorf("ocsp response status <%d>", res.Status)
+	}
+	if !res.Response.ResponseType.Equal(oidOCSPBasicResponse) {
+		return nil, ErrInvalidOCSPResponse
+	}
+	var basic ocspBasicResponse
+	_, err = asn1.Unmarshal(res.Response.Response, &basic)
+	if err != nil {
+		return nil, ErrInvalidOCSPResponse
+	}
+	var tbs ocspResponseData
+	_, err = asn1.Unmarshal(basic.TBSResponseData.FullBytes, &tbs)
+	if err != nil {
+		return nil, ErrInvalidOCSPResponse
+	}
+	// 签名者是颁发者，或者颁发者授权的ocsp证书
+	alg := x509.UnknownSignatureAlgorithm
+	for _, a := range ocspSignatureAlgorithms {
+		if a.oid.Equal(basic.SignatureAlgorithm.Algorithm) {
+			alg = a.alg
+		}
+	}
+	signer := issuer
+	if len(basic.Certificates) > 0 {
+		c, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return nil, ErrInvalidOCSPResponse
+		}
+		if !bytes.Equal(c.Raw, issuer.Raw) {
+			err = c.CheckSignatureFrom(issuer)
+			if err != nil {
+				return nil, err
+			}
+			if !hasExtKeyUsage(c, x509.ExtKeyUsageOCSPSigning) {
+				return nil, ErrInvalidOCSPResponse
+			}
+			if now.Before(c.NotBefore) || now.After(c.NotAfter) {
+				return nil, ErrInvalidOCSPResponse
+			}
+			signer = c
+		}
+	}
+	err = signer.CheckSignature(alg, tbs.Raw, basic.Signature.RightAlign())
+	if err != nil {
+		return nil, err
+	}
+	for i := range tbs.Responses {
+		r := &tbs.Responses[i]
+		if !r.CertID.equal(id) {
+			continue
+		}
+		if now.Before(r.ThisUpdate) {
+			return nil, ErrInvalidOCSPResponse
+		}
+		if !r.NextUpdate.IsZero() && now.After(r.NextUpdate) {
+			return nil, ErrInvalidOCSPResponse
+		}
+		result := new(ocspResult)
+		result.nextUpdate = r.NextUpdate
+		switch {
+		case bool(r.Good):
+			result.status = ocspGood
+		case bool(r.Unknown):
+			result.status = ocspUnknown
+		default:
+			result.status = ocspRevoked
+		}
+		return result, nil
+	}
+	return nil, ErrInvalidOCSPResponse
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrKeyUsage = errors.New("key usage not allowed")
+)
+
+// 对称key的用途
+type KeyUsage int
+
+const (
+	KeyUsageSign    KeyUsage = 1 << iota // hs算法签名和验证
+	KeyUsageEncrypt                      // jwe的gcmkw和dir
+)
+
+// 对称key
+type OctetKey struct {
+	Kid    string
+	Alg    Alg // 不为空只能用于这个算法
+	Secret []byte
+	Usage  KeyUsage
+}
+
+// 检查key是否可以用于alg
+func (k *OctetKey) allow(alg Alg, usage KeyUsage) error {
+	if k.Usage&usage == 0 {
+		return ErrKeyUsage
+	}
+	if k.Alg != "" && k.Alg != alg {
+		return ErrUnsupportedAlg
+	}
+	return nil
+}
+
+func NewOctetKeySet() *OctetKeySet {
+	s := new(OctetKeySet)
+	s.keys = make(map[string]*OctetKey)
+	return s
+}
+
+// 使用kid选择的对称key集合，同时用于hs签名和jwe
+type OctetKeySet struct {
+	lock sync.RWMutex
+	keys map[string]*OctetKey
+}
+
+// 添加或者替换key，kid不能为空
+func (s *OctetKeySet) Add(key *OctetKey) error {
+	if key.Kid == "" || len(key.Secret) < 1 || key.Usage == 0 {
+		return ErrUnsupportedKey
+	}
+	s.lock.Lock()
+	s.keys[key.Kid] = key
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *OctetKeySet) Remove(kid string) {
+	s.lock.Lock()
+	delete(s.keys, kid)
+	s.lock.Unlock()
+}
+
+// 没有返回nil
+func (s *OctetKeySet) Get(kid string) *OctetKey {
+	s.lock.RLock()
+	k := s.keys[kid]
+	s.lock.RUnlock()
+	return k
+}
+
+// 所有的key，按照kid排序
+func (s *OctetKeySet) Keys() []*OctetKey {
+	s.lock.RLock()
+	keys := make([]*OctetKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	s.lock.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Kid < keys[j].Kid
+	})
+	return keys
+}
+
+// 返回kid对应的key，检查用途和算法
+func (s *OctetKeySet) secret(kid string, alg Alg, usage KeyUsage) ([]byte, error) {
+	k := s.Get(kid)
+	if k == nil {
+		return nil, ErrKeyNotFound
+	}
+	err := k.allow(alg, usage)
+	if err != nil {
+		return nil, err
+	}
+	return k.Secret, nil
+}
+
+// 使用kid的key签名，header.kid设置成kid
+func (s *OctetKeySet) Sign(alg Alg, kid string, header, payload Claims, config *Config) (string, error) {
+	if !strings.HasPrefix(string(alg), "HS") {
+		return "", fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+	secret, err := s.secret(kid, alg, KeyUsageSign)
+	if err != nil {
+		return "", err
+	}
+	header = copyClaims(header, 1)
+	header["kid"] = kid
+	return SignWithKey(alg, header, payload, secret, config)
+}
+
+// 实现KeyFunc，验证hs算法的签名
+func (s *OctetKeySet) KeyFunc(header Claims) (interface{}, error) {
+	kid, _ := header["kid"].(string)
+	alg, _ := header["alg"].(string)
+	if !strings.HasPrefix(alg, "HS") {
+		return nil, ErrUnsupportedAlg
+	}
+	return s.secret(kid, Alg(alg), KeyUsageSign)
+}
+
+// 实现DecryptionKeyProvider，用于gcmkw和dir
+func (s *OctetKeySet) DecryptionKey(header Claims) (interface{}, error) {
+	kid, _ := header["kid"].(string)
+	alg, _ := header["alg"].(string)
+	switch Alg(alg) {
+	case A128GCMKWAlg, A192GCMKWAlg, A256GCMKWAlg, DirAlg:
+		return s.secret(kid, Alg(alg), KeyUsageEncrypt)
+	}
+	return nil, fmt.Errorf("unsupported algorithm <%s>", alg)
+}
+
+// 使用kid的key加密的接收者，alg是gcmkw或者dir
+func (s *OctetKeySet) Recipient(kid string, alg Alg, enc Enc) (*Recipient, error) {
+	switch alg {
+	case A128GCMKWAlg, A192GCMKWAlg, A256GCMKWAlg, DirAlg:
+	default:
+		return nil, fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+	secret, err := s.secret(kid, alg, KeyUsageEncrypt)
+	if err != nil {
+		return nil, err
+	}
+	r := new(Recipient)
+	r.Alg = alg
+	r.Enc = enc
+	r.Key = secret
+	r.KeyID = kid
+	return r, nil
+}
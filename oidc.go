@@ -0,0 +1,140 @@
+package jwt
+
+import (
+	"encoding/base64"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidIssuer   = errors.New("invalid issuer")
+	ErrInvalidAudience = errors.New("invalid audience")
+	ErrInvalidNonce    = errors.New("invalid nonce")
+	ErrAuthTimeExpired = errors.New("auth_time exceeds max_age")
+	ErrInvalidAtHash   = errors.New("invalid at_hash")
+	ErrInvalidCHash    = errors.New("invalid c_hash")
+)
+
+// 验证通过的oidc id token
+type IDToken struct {
+	Issuer          string
+	Subject         string
+	Audience        []string
+	AuthorizedParty string
+	Nonce           string
+	Expiry          time.Time
+	IssuedAt        time.Time
+	AuthTime        time.Time // 没有auth_time是零值
+	AccessTokenHash string
+	CodeHash        string
+	Header          Claims
+	Claims          Claims // 所有字段
+}
+
+// oidc id token验证
+type IDTokenValidator struct {
+	Provider Provider      // 签名验证
+	Issuer   string        // 必须和iss相同
+	ClientID string        // 必须在aud中
+	MaxAge   time.Duration // 大于0，要求auth_time不早于max_age
+}
+
+// 验证id token，nonce是认证请求的nonce，
+// accessToken和code不为空，token中必须有at_hash和c_hash，并且要相同
+func (v *IDTokenValidator) Validate(token, nonce, accessToken, code string) (*IDToken, error) {
+	header, payload, err := Verify(token, v.Provider)
+	if err != nil {
+		return nil, err
+	}
+	t := new(IDToken)
+	t.Header = header
+	t.Claims = payload
+	t.Issuer, _ = payload["iss"].(string)
+	t.Subject, _ = payload["sub"].(string)
+	t.Audience = claimStrings(payload, "aud")
+	t.AuthorizedParty, _ = payload["azp"].(string)
+	t.Nonce, _ = payload["nonce"].(string)
+	t.AccessTokenHash, _ = payload["at_hash"].(string)
+	t.CodeHash, _ = payload["c_hash"].(string)
+	exp, ok := claimInt64(payload, "exp")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	t.Expiry = time.Unix(exp, 0)
+	iat, ok := claimInt64(payload, "iat")
+	if !ok || t.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+	t.IssuedAt = time.Unix(iat, 0)
+	// iss
+	if t.Issuer != v.Issuer {
+		return nil, ErrInvalidIssuer
+	}
+	// aud和azp
+	if !containsString(t.Audience, v.ClientID) {
+		return nil, ErrInvalidAudience
+	}
+	if len(t.Audience) > 1 && t.AuthorizedParty == "" {
+		return nil, ErrInvalidAudience
+	}
+	if t.AuthorizedParty != "" && t.AuthorizedParty != v.ClientID {
+		return nil, ErrInvalidAudience
+	}
+	// nonce
+	if nonce != "" && t.Nonce != nonce {
+		return nil, ErrInvalidNonce
+	}
+	// auth_time
+	authTime, ok := claimInt64(payload, "auth_time")
+	if ok {
+		t.AuthTime = time.Unix(authTime, 0)
+	}
+	if v.MaxAge > 0 {
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		config := configOf(v.Provider)
+		if config.now().After(t.AuthTime.Add(v.MaxAge + config.Leeway)) {
+			return nil, ErrAuthTimeExpired
+		}
+	}
+	// at_hash和c_hash
+	alg, _ := header["alg"].(string)
+	if accessToken != "" {
+		if t.AccessTokenHash == "" {
+			return nil, ErrInvalidAtHash
+		}
+		h, err := OIDCHash(Alg(alg), accessToken)
+		if err != nil {
+			return nil, err
+		}
+		if h != t.AccessTokenHash {
+			return nil, ErrInvalidAtHash
+		}
+	}
+	if code != "" {
+		if t.CodeHash == "" {
+			return nil, ErrInvalidCHash
+		}
+		h, err := OIDCHash(Alg(alg), code)
+		if err != nil {
+			return nil, err
+		}
+		if h != t.CodeHash {
+			return nil, ErrInvalidCHash
+		}
+	}
+	return t, nil
+}
+
+// at_hash和c_hash的计算，使用alg对应的sha2，取左边一半做base64
+func OIDCHash(alg Alg, value string) (string, error) {
+	c := alg.Hash()
+	if c == 0 {
+		return "", ErrUnsupportedAlg
+	}
+	h := c.New()
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
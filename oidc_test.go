@@ -0,0 +1,270 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试id token验证
+func Test_IDTokenValidator(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	v := &IDTokenValidator{
+		Provider: pro,
+		Issuer:   "https://idp",
+		ClientID: "client",
+		MaxAge:   time.Hour,
+	}
+	for _, alg := range []Alg{HS256Alg, RS384Alg, ES512Alg} {
+		atHash, _ := OIDCHash(alg, "access")
+		payload := NewPayload()
+		payload.SetISS("https://idp")
+		payload.SetSUB("user")
+		payload.SetAUD("client", "other")
+		payload.SetEXP(time.Hour)
+		payload["azp"] = "client"
+		payload["nonce"] = "n"
+		payload["auth_time"] = time.Now().Add(-time.Minute).Unix()
+		payload["at_hash"] = atHash
+		token, err := Sign(alg, make(Claims), Claims(payload), pro)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := v.Validate(token, "n", "access", "")
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		if id.Subject != "user" || len(id.Audience) != 2 || id.AuthorizedParty != "client" {
+			t.FailNow()
+		}
+		_, err = v.Validate(token, "x", "access", "")
+		if err != ErrInvalidNonce {
+			t.Fatal(err)
+		}
+		_, err = v.Validate(token, "n", "other", "")
+		if err != ErrInvalidAtHash {
+			t.Fatal(err)
+		}
+		// 没有c_hash
+		_, err = v.Validate(token, "n", "access", "code")
+		if err != ErrInvalidCHash {
+			t.Fatal(err)
+		}
+		// 没有at_hash
+		delete(payload, "at_hash")
+		token, _ = Sign(alg, make(Claims), Claims(payload), pro)
+		_, err = v.Validate(token, "n", "access", "")
+		if err != ErrInvalidAtHash {
+			t.Fatal(err)
+		}
+		// aud没有client
+		payload.SetAUD("other")
+		delete(payload, "azp")
+		token, _ = Sign(alg, make(Claims), Claims(payload), pro)
+		_, err = v.Validate(token, "n", "", "")
+		if err != ErrInvalidAudience {
+			t.Fatal(err)
+		}
+		// 多个aud，azp不是client
+		payload.SetAUD("client", "other")
+		payload["azp"] = "other"
+		token, _ = Sign(alg, make(Claims), Claims(payload), pro)
+		_, err = v.Validate(token, "n", "", "")
+		if err != ErrInvalidAudience {
+			t.Fatal(err)
+		}
+		// auth_time超过max_age
+		payload["azp"] = "client"
+		payload["auth_time"] = time.Now().Add(-2 * time.Hour).Unix()
+		token, _ = Sign(alg, make(Claims), Claims(payload), pro)
+		_, err = v.Validate(token, "n", "", "")
+		if err != ErrAuthTimeExpired {
+			t.Fatal(err)
+		}
+		// 有max_age，没有auth_time
+		delete(payload, "auth_time")
+		token, _ = Sign(alg, make(Claims), Claims(payload), pro)
+		_, err = v.Validate(token, "n", "", "")
+		if err != ErrInvalidToken {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 测试发现文档和jwks验证
+func Test_Discovery(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	handler := NewDiscoveryHandler("", pro)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	handler.Issuer = server.URL
+	client, err := Discover(server.Client(), server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Document.IDTokenSigningAlgValuesSupported) != 9 {
+		t.FailNow()
+	}
+	for _, alg := range pro.Algs() {
+		payload := NewPayload()
+		payload.SetISS(server.URL)
+		token, err := Sign(alg, make(Claims), Claims(payload), pro)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = client.Verify(token)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+	}
+	// hs算法不能通过jwks验证
+	token, _ := Sign(HS256Alg, make(Claims), Claims{"iss": server.URL}, pro)
+	_, _, err = client.Verify(token)
+	if err != ErrUnsupportedAlg {
+		t.Fatal(err)
+	}
+	// issuer不对
+	token, _ = Sign(RS256Alg, make(Claims), Claims{"iss": "other"}, pro)
+	_, _, err = client.Verify(token)
+	if err != ErrInvalidIssuer {
+		t.Fatal(err)
+	}
+}
+
+// 测试jwks刷新时不阻塞其他验证，使用config的时间，响应的大小限制
+func Test_RemoteJWKS(t *testing.T) {
+	pro := NewDefaultProvider("", "", "")
+	block := make(chan struct{})
+	var big, blocking int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&big) == 1 {
+			w.Write([]byte(`{"keys":[` + strings.Repeat(" ", maxJSONBody) + `]}`))
+			return
+		}
+		if atomic.LoadInt32(&blocking) == 1 {
+			<-block
+		}
+		writeJSON(w, http.StatusOK, pro.JWKS())
+	}))
+	defer server.Close()
+	now := time.Unix(1600000000, 0)
+	var lock sync.Mutex
+	config := &Config{Clock: ClockFunc(func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	})}
+	jwks := NewRemoteJWKS(server.Client(), server.URL, config)
+	err := jwks.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&blocking, 1)
+	token, _ := Sign(ES256Alg, make(Claims), make(Claims), pro)
+	// 没有超过刷新间隔，不会获取
+	_, err = jwks.KeyFunc(Claims{"kid": "unknown", "alg": "ES256"})
+	if err == nil {
+		t.FailNow()
+	}
+	// 超过刷新间隔，获取被阻塞的时候，缓存中的key还可以使用
+	lock.Lock()
+	now = now.Add(time.Minute)
+	lock.Unlock()
+	done := make(chan error)
+	go func() {
+		_, err := jwks.KeyFunc(Claims{"kid": "unknown", "alg": "ES256"})
+		done <- err
+	}()
+	for i := 0; ; i++ {
+		jwks.lock.Lock()
+		fetching := jwks.fetch != nil
+		jwks.lock.Unlock()
+		if fetching {
+			break
+		}
+		if i > 100 {
+			t.Fatal("not fetching")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, _, err = VerifyWithKeyFunc(token, jwks.KeyFunc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(block)
+	if <-done == nil {
+		t.FailNow()
+	}
+	// 太大的响应
+	atomic.StoreInt32(&big, 1)
+	if jwks.Refresh() == nil {
+		t.FailNow()
+	}
+}
+
+// 测试多个签发者的验证
+func Test_MultiIssuerVerifier(t *testing.T) {
+	internal := NewDefaultProvider("hs256", "hs384", "hs512")
+	partner := NewDefaultProvider("hs256", "hs384", "hs512")
+	v := NewMultiIssuerVerifier(
+		&TrustedIssuer{Issuer: "internal", Algs: []Alg{ES256Alg}, Audiences: []string{"gateway"}, KeyFunc: internal.JWKS().KeyFunc},
+		&TrustedIssuer{Issuer: "partner", Algs: []Alg{RS256Alg}, Provider: partner},
+	)
+	v.Add(&TrustedIssuer{Algs: []Alg{HS256Alg}, KeyFunc: func(Claims) (interface{}, error) {
+		return []byte("legacy"), nil
+	}})
+	sign := func(alg Alg, iss string, pro Provider) string {
+		payload := NewPayload()
+		if iss != "" {
+			payload.SetISS(iss)
+		}
+		payload.SetAUD("gateway")
+		token, err := Sign(alg, make(Claims), Claims(payload), pro)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	for _, token := range []string{
+		sign(ES256Alg, "internal", internal),
+		sign(RS256Alg, "partner", partner),
+		sign(HS256Alg, "", NewDefaultProvider("legacy", "", "")),
+	} {
+		_, _, err := v.Verify(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 不认识的签发者
+	_, _, err := v.Verify(sign(ES256Alg, "other", internal))
+	if err != ErrUnknownIssuer {
+		t.Fatal(err)
+	}
+	// 别的签发者的key
+	_, _, err = v.Verify(sign(RS256Alg, "partner", internal))
+	if err == nil {
+		t.FailNow()
+	}
+	// 不允许的算法
+	_, _, err = v.Verify(sign(HS256Alg, "partner", partner))
+	if err != ErrUnsupportedAlg {
+		t.Fatal(err)
+	}
+	// aud
+	payload := NewPayload()
+	payload.SetISS("internal")
+	token, _ := Sign(ES256Alg, make(Claims), Claims(payload), internal)
+	_, _, err = v.Verify(token)
+	if err != ErrInvalidAudience {
+		t.Fatal(err)
+	}
+	v.Remove("partner")
+	_, _, err = v.Verify(sign(RS256Alg, "partner", partner))
+	if err != ErrUnknownIssuer {
+		t.Fatal(err)
+	}
+}
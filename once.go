@@ -0,0 +1,38 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrTokenConsumed = errors.New("token already consumed")
+)
+
+// 一次性token的存储，MemoryRevocationStore和FileRevocationStore都实现了
+type ConsumeStore interface {
+	// 原子的标记jti已经使用，exp之后不再需要保存，已经使用过返回false
+	Consume(jti string, exp time.Time) (bool, error)
+}
+
+// 验证只能使用一次的token，比如登录链接，重置密码，邮箱确认，
+// 验证通过之后标记jti已经使用，再次验证返回ErrTokenConsumed
+func VerifyOnce(token string, provider Provider, store ConsumeStore) (header, payload Claims, err error) {
+	header, payload, err = Verify(token, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	jti, ok := payload["jti"].(string)
+	if !ok || jti == "" {
+		return nil, nil, ErrInvalidToken
+	}
+	// Verify在exp加上Leeway之前都会接受，记录要保存到这个时间
+	ok, err = store.Consume(jti, payloadExpiry(payload, configOf(provider)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, ErrTokenConsumed
+	}
+	return
+}
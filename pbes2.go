@@ -0,0 +1,241 @@
+package jwt
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// rfc7518 4.8 pbes2，口令加密cek
+
+const (
+	PBES2HS256A128KWAlg Alg = "PBES2-HS256+A128KW"
+	PBES2HS384A192KWAlg Alg = "PBES2-HS384+A192KW"
+	PBES2HS512A256KWAlg Alg = "PBES2-HS512+A256KW"
+)
+
+const (
+	PBES2DefaultCount = 600000  // 加密默认的迭代次数
+	PBES2MinCount     = 1000    // 解密允许的最小迭代次数，rfc7518建议的最小值
+	PBES2MaxCount     = 1000000 // 解密允许的最大迭代次数，token的p2c由对方控制，防止dos
+	pbes2MinSaltSize  = 8
+)
+
+var (
+	ErrInvalidPBES2Count = errors.New("invalid pbes2 count")
+)
+
+// 返回prf和kek的字节数
+func pbes2Params(alg Alg) (func() hash.Hash, int) {
+	switch alg {
+	case PBES2HS256A128KWAlg:
+		return sha256.New, 16
+	case PBES2HS384A192KWAlg:
+		return sha512.New384, 24
+	default:
+		return sha512.New, 32
+	}
+}
+
+// 口令只能是string，[]byte是hs的secret或者gcmkw的key，不能当成口令使用
+func pbes2Password(key interface{}) ([]byte, error) {
+	if k, ok := key.(string); ok {
+		return []byte(k), nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+func pbes2Wrap(r *Recipient, header Claims, size int, config *Config) (cek, encryptedKey []byte, err error) {
+	password, err := pbes2Password(r.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	count := r.P2C
+	if count == 0 {
+		count = PBES2DefaultCount
+	}
+	if count < PBES2MinCount || count > PBES2MaxCount {
+		return nil, nil, ErrInvalidPBES2Count
+	}
+	salt := r.P2S
+	if salt == nil {
+		salt, err = randomBytes(config.random(), 16)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(salt) < pbes2MinSaltSize {
+		return nil, nil, fmt.Errorf("pbes2 salt must be at least %d bytes", pbes2MinSaltSize)
+	}
+	header["p2s"] = base64.RawURLEncoding.EncodeToString(salt)
+	header["p2c"] = count
+	prf, n := pbes2Params(r.Alg)
+	kek := pbkdf2(prf, password, pbes2Salt(r.Alg, salt), count, n)
+	cek, err = randomBytes(config.random(), size)
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedKey, err = aesKeyWrap(kek, cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cek, encryptedKey, nil
+}
+
+func pbes2Unwrap(alg Alg, header Claims, encryptedKey []byte, key interface{}, size int) ([]byte, error) {
+	password, err := pbes2Password(key)
+	if err != nil {
+		return nil, err
+	}
+	count, ok := claimInt64(header, "p2c")
+	if !ok || count < PBES2MinCount || count > PBES2MaxCount {
+		return nil, ErrInvalidPBES2Count
+	}
+	p2s, _ := header["p2s"].(string)
+	salt, err := base64.RawURLEncoding.DecodeString(p2s)
+	if err != nil || len(salt) < pbes2MinSaltSize {
+		return nil, ErrInvalidToken
+	}
+	prf, n := pbes2Params(alg)
+	kek := pbkdf2(prf, password, pbes2Salt(alg, salt), int(count), n)
+	cek, err := aesKeyUnwrap(kek, encryptedKey)
+	if err != nil || len(cek) != size {
+		return nil, ErrDecryption
+	}
+	return cek, nil
+}
+
+// alg || 0x00 || p2s
+func pbes2Salt(alg Alg, p2s []byte) []byte {
+	salt := make([]byte, 0, len(alg)+1+len(p2s))
+	salt = append(salt, alg...)
+	salt = append(salt, 0)
+	return append(salt, p2s...)
+}
+
+// rfc8018 pbkdf2
+func pbkdf2(prf func() hash.Hash, password, salt []byte, count, size int) []byte {
+	m := hmac.New(prf, password)
+	n := m.Size()
+	key := make([]byte, 0, (size+n-1)/n*n)
+	var block [4]byte
+	u := make([]byte, n)
+	t := make([]byte, n)
+	for i := 1; len(key) < size; i++ {
+		binary.BigEndian.PutUint32(block[:], uint32(i))
+		m.Reset()
+		m.Write(salt)
+		m.Write(block[:])
+		u = m.Sum(u[:0])
+		copy(t, u)
+		for j := 1; j < count; j++ {
+			m.Reset()
+			m.Write(u)
+			u = m.Sum(u[:0])
+			for k := range t {
+				t[k] ^= u[k]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:size]
+}
+
+// rfc3394 aes key wrap的默认iv
+var aesKeyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// rfc3394 aes key wrap
+func aesKeyWrap(kek, cek []byte) ([]byte, error) {
+	if len(cek) < 16 || len(cek)%8 != 0 {
+		return nil, ErrUnsupportedKey
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(cek) / 8
+	r := make([]byte, len(cek))
+	copy(r, cek)
+	var b [16]byte
+	copy(b[:8], aesKeyWrapIV)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			copy(b[8:], r[i*8:i*8+8])
+			block.Encrypt(b[:], b[:])
+			t := uint64(n*j + i + 1)
+			v := binary.BigEndian.Uint64(b[:8]) ^ t
+			binary.BigEndian.PutUint64(b[:8], v)
+			copy(r[i*8:], b[8:])
+		}
+	}
+	out := make([]byte, 8+len(r))
+	copy(out, b[:8])
+	copy(out[8:], r)
+	return out, nil
+}
+
+// rfc3394 aes key unwrap，完整性检查失败返回ErrDecryption
+func aesKeyUnwrap(kek, data []byte) ([]byte, error) {
+	if len(data) < 24 || len(data)%8 != 0 {
+		return nil, ErrDecryption
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(data)/8 - 1
+	r := make([]byte, n*8)
+	copy(r, data[8:])
+	var b [16]byte
+	copy(b[:8], data[:8])
+	for j := 5; j >= 0; j-- {
+		for i := n - 1; i >= 0; i-- {
+			t := uint64(n*j + i + 1)
+			v := binary.BigEndian.Uint64(b[:8]) ^ t
+			binary.BigEndian.PutUint64(b[:8], v)
+			copy(b[8:], r[i*8:i*8+8])
+			block.Decrypt(b[:], b[:])
+			copy(r[i*8:], b[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(b[:8], aesKeyWrapIV) != 1 {
+		return nil, ErrDecryption
+	}
+	return r, nil
+}
+
+// 加密jwk set，header.cty是"jwk-set+json"
+func EncryptJWKSet(set *JWKSet, recipient *Recipient, config *Config) (string, error) {
+	data, err := json.Marshal(set)
+	if err != nil {
+		return "", err
+	}
+	header := make(Claims)
+	header["cty"] = "jwk-set+json"
+	return Encrypt(data, header, recipient, config)
+}
+
+// 解密EncryptJWKSet的结果
+func DecryptJWKSet(token string, keyFunc KeyFunc, config *Config) (*JWKSet, error) {
+	header, data, err := Decrypt(token, keyFunc, config)
+	if err != nil {
+		return nil, err
+	}
+	if header["cty"] != "jwk-set+json" {
+		return nil, ErrInvalidTokenType
+	}
+	set := new(JWKSet)
+	err = json.Unmarshal(data, set)
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
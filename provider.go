@@ -5,10 +5,12 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/hmac"
-	"crypto/rand"
 	"crypto/rsa"
+	"fmt"
 	"hash"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // hash和key提供的接口，应该是一个缓存池
@@ -40,7 +42,19 @@ type Provider interface {
 }
 
 func NewDefaultProvider(hsSecret256, hsSecret384, hsSecret512 string) *DefaultProvider {
+	return NewDefaultProviderWithConfig(nil, hsSecret256, hsSecret384, hsSecret512)
+}
+
+// config是nil使用DefaultConfig，生成密钥使用config的随机数来源，但是不保证可重复
+func NewDefaultProviderWithConfig(config *Config, hsSecret256, hsSecret384, hsSecret512 string) *DefaultProvider {
 	p := new(DefaultProvider)
+	p.kid = make(map[Alg]string)
+	p.octets = NewOctetKeySet()
+	p.lifetime = make(map[Alg]*KeyLifetime)
+	p.config = config
+	if p.config == nil {
+		p.config = DefaultConfig
+	}
 	// hash
 	{
 		p.sha256.New = func() interface{} {
@@ -55,15 +69,9 @@ func NewDefaultProvider(hsSecret256, hsSecret384, hsSecret512 string) *DefaultPr
 	}
 	// hs
 	{
-		p.hs256.New = func() interface{} {
-			return hmac.New(crypto.SHA256.New, []byte(hsSecret256))
-		}
-		p.hs384.New = func() interface{} {
-			return hmac.New(crypto.SHA384.New, []byte(hsSecret384))
-		}
-		p.hs512.New = func() interface{} {
-			return hmac.New(crypto.SHA512.New, []byte(hsSecret512))
-		}
+		p.SetHS256Key(hsSecret256)
+		p.SetHS384Key(hsSecret384)
+		p.SetHS512Key(hsSecret512)
 	}
 	// rs
 	{
@@ -87,51 +95,84 @@ func NewDefaultProvider(hsSecret256, hsSecret384, hsSecret512 string) *DefaultPr
 }
 
 type DefaultProvider struct {
-	sha256   sync.Pool         // 哈希缓存
-	sha384   sync.Pool         // 哈希缓存
-	sha512   sync.Pool         // 哈希缓存
-	hs256    sync.Pool         // hs算法的哈希缓存
-	hs384    sync.Pool         // hs算法的哈希缓存
-	hs512    sync.Pool         // hs算法的哈希缓存
-	rs256    *rsa.PrivateKey   // rs算法私钥
-	rs384    *rsa.PrivateKey   // rs算法私钥
-	rs512    *rsa.PrivateKey   // rs算法私钥
-	es256    *ecdsa.PrivateKey // es算法私钥
-	es384    *ecdsa.PrivateKey // es算法私钥
-	es512    *ecdsa.PrivateKey // es算法私钥
-	ps256    *rsa.PrivateKey   // ps算法私钥
-	ps384    *rsa.PrivateKey   // ps算法私钥
-	ps512    *rsa.PrivateKey   // ps算法私钥
-	ps256Opt *rsa.PSSOptions   // ps算法加密选项
-	ps384Opt *rsa.PSSOptions   // ps算法加密选项
-	ps512Opt *rsa.PSSOptions   // ps算法加密选项
+	sha256   sync.Pool                 // 哈希缓存
+	sha384   sync.Pool                 // 哈希缓存
+	sha512   sync.Pool                 // 哈希缓存
+	hs256    atomic.Pointer[sync.Pool] // hs算法的哈希缓存，换secret时整个替换
+	hs384    atomic.Pointer[sync.Pool] // hs算法的哈希缓存，换secret时整个替换
+	hs512    atomic.Pointer[sync.Pool] // hs算法的哈希缓存，换secret时整个替换
+	rs256    *rsa.PrivateKey           // rs算法私钥
+	rs384    *rsa.PrivateKey           // rs算法私钥
+	rs512    *rsa.PrivateKey           // rs算法私钥
+	es256    *ecdsa.PrivateKey         // es算法私钥
+	es384    *ecdsa.PrivateKey         // es算法私钥
+	es512    *ecdsa.PrivateKey         // es算法私钥
+	ps256    *rsa.PrivateKey           // ps算法私钥
+	ps384    *rsa.PrivateKey           // ps算法私钥
+	ps512    *rsa.PrivateKey           // ps算法私钥
+	ps256Opt *rsa.PSSOptions           // ps算法加密选项
+	ps384Opt *rsa.PSSOptions           // ps算法加密选项
+	ps512Opt *rsa.PSSOptions           // ps算法加密选项
+	config   *Config                   // 时间和随机数来源
+	keyLock  sync.RWMutex              // 保护rs，es，ps，kid和encKey，可以在签名验证的同时更换key
+	kid      map[Alg]string            // 非对称算法公钥的rfc7638指纹
+	octets   *OctetKeySet              // 对称key，hs算法的secret使用算法名作为kid
+	encKey   *rsa.PrivateKey           // jwe的解密私钥，和签名的key分开
+	encKID   string                    // encKey公钥的rfc7638指纹
+	retired  map[string]*retiredKey    // FileKeyStore设置的退役key，使用kid查找
+	ltLock   sync.RWMutex
+	lifetime map[Alg]*KeyLifetime // 算法key的有效期，没有表示不限制
+}
+
+func (p *DefaultProvider) Config() *Config {
+	return p.config
+}
+
+// hs算法的哈希，记录来自哪个缓存池，
+// 换secret之后，旧的哈希放回旧的缓存池，不会被新的签名使用
+type hsHash struct {
+	hash.Hash
+	pool *sync.Pool
+}
+
+// secret的缓存池
+func newHSPool(newHash func() hash.Hash, secret string) *sync.Pool {
+	pool := new(sync.Pool)
+	pool.New = func() interface{} {
+		return &hsHash{Hash: hmac.New(newHash, []byte(secret)), pool: pool}
+	}
+	return pool
+}
+
+func putHS(hash hash.Hash) {
+	if h, ok := hash.(*hsHash); ok {
+		h.Reset()
+		h.pool.Put(h)
+	}
 }
 
 func (p *DefaultProvider) GetHS256() hash.Hash {
-	return p.hs256.Get().(hash.Hash)
+	return p.hs256.Load().Get().(hash.Hash)
 }
 
 func (p *DefaultProvider) GetHS384() hash.Hash {
-	return p.hs384.Get().(hash.Hash)
+	return p.hs384.Load().Get().(hash.Hash)
 }
 
 func (p *DefaultProvider) GetHS512() hash.Hash {
-	return p.hs512.Get().(hash.Hash)
+	return p.hs512.Load().Get().(hash.Hash)
 }
 
 func (p *DefaultProvider) PutHS256(hash hash.Hash) {
-	hash.Reset()
-	p.hs256.Put(hash)
+	putHS(hash)
 }
 
 func (p *DefaultProvider) PutHS384(hash hash.Hash) {
-	hash.Reset()
-	p.hs384.Put(hash)
+	putHS(hash)
 }
 
 func (p *DefaultProvider) PutHS512(hash hash.Hash) {
-	hash.Reset()
-	p.hs512.Put(hash)
+	putHS(hash)
 }
 
 func (p *DefaultProvider) GetSha256() hash.Hash {
@@ -162,142 +203,662 @@ func (p *DefaultProvider) PutSha512(hash hash.Hash) {
 }
 
 func (p *DefaultProvider) RS256Key() *rsa.PrivateKey {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.rs256
 }
 
 func (p *DefaultProvider) RS384Key() *rsa.PrivateKey {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.rs384
 }
 
 func (p *DefaultProvider) RS512Key() *rsa.PrivateKey {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.rs512
 }
 
 func (p *DefaultProvider) ES256Key() *ecdsa.PrivateKey {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.es256
 }
 
 func (p *DefaultProvider) ES384Key() *ecdsa.PrivateKey {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.es384
 }
 
 func (p *DefaultProvider) ES512Key() *ecdsa.PrivateKey {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.es512
 }
 
 func (p *DefaultProvider) PS256Key() *rsa.PrivateKey {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.ps256
 }
 
 func (p *DefaultProvider) PS384Key() *rsa.PrivateKey {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.ps384
 }
 
 func (p *DefaultProvider) PS512Key() *rsa.PrivateKey {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.ps512
 }
 
 func (p *DefaultProvider) PS256Opt() *rsa.PSSOptions {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.ps256Opt
 }
 
 func (p *DefaultProvider) PS384Opt() *rsa.PSSOptions {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.ps384Opt
 }
 
 func (p *DefaultProvider) PS512Opt() *rsa.PSSOptions {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
 	return p.ps512Opt
 }
 
-func (p *DefaultProvider) SetHS256Key(secret string) {
-	p.hs256.New = func() interface{} {
-		return hmac.New(crypto.SHA256.New, []byte(secret))
+// hs的secret也保存在octets中，只能用于签名，
+// 原子的替换整个哈希缓存池，旧secret的哈希不会再被使用
+func (p *DefaultProvider) setHSKey(alg Alg, secret string) {
+	k := new(OctetKey)
+	k.Kid = string(alg)
+	k.Alg = alg
+	k.Secret = []byte(secret)
+	k.Usage = KeyUsageSign
+	if p.octets.Add(k) != nil {
+		p.octets.Remove(k.Kid)
 	}
+	switch alg {
+	case HS256Alg:
+		p.hs256.Store(newHSPool(crypto.SHA256.New, secret))
+	case HS384Alg:
+		p.hs384.Store(newHSPool(crypto.SHA384.New, secret))
+	default:
+		p.hs512.Store(newHSPool(crypto.SHA512.New, secret))
+	}
+}
+
+// 对称key集合，和hs算法的secret在一起，
+// 添加的key使用kid选择，用于hs签名或者jwe的gcmkw和dir
+func (p *DefaultProvider) OctetKeys() *OctetKeySet {
+	return p.octets
+}
+
+// 可以和签名验证同时调用，会清除kid和有效期
+func (p *DefaultProvider) SetHS256Key(secret string) {
+	p.setSignKey(HS256Alg, "", func() {
+		p.setHSKey(HS256Alg, secret)
+	})
 }
 
 func (p *DefaultProvider) SetHS384Key(secret string) {
-	p.hs384.New = func() interface{} {
-		return hmac.New(crypto.SHA256.New, []byte(secret))
-	}
+	p.setSignKey(HS384Alg, "", func() {
+		p.setHSKey(HS384Alg, secret)
+	})
 }
 
 func (p *DefaultProvider) SetHS512Key(secret string) {
-	p.hs512.New = func() interface{} {
-		return hmac.New(crypto.SHA256.New, []byte(secret))
-	}
+	p.setSignKey(HS512Alg, "", func() {
+		p.setHSKey(HS512Alg, secret)
+	})
 }
 
 func (p *DefaultProvider) SetRS256Key(key *rsa.PrivateKey) {
-	p.rs256 = key
+	p.setSignKey(RS256Alg, rsaKeyID(key), func() {
+		p.rs256 = key
+	})
 }
 
 func (p *DefaultProvider) SetRS384Key(key *rsa.PrivateKey) {
-	p.rs384 = key
+	p.setSignKey(RS384Alg, rsaKeyID(key), func() {
+		p.rs384 = key
+	})
 }
 
 func (p *DefaultProvider) SetRS512Key(key *rsa.PrivateKey) {
-	p.rs512 = key
+	p.setSignKey(RS512Alg, rsaKeyID(key), func() {
+		p.rs512 = key
+	})
 }
 
 func (p *DefaultProvider) SetPS256Key(key *rsa.PrivateKey, opt *rsa.PSSOptions) {
-	p.ps256 = key
-	p.ps256Opt = opt
+	p.setSignKey(PS256Alg, rsaKeyID(key), func() {
+		p.ps256 = key
+		p.ps256Opt = opt
+	})
 }
 
 func (p *DefaultProvider) SetPS384Key(key *rsa.PrivateKey, opt *rsa.PSSOptions) {
-	p.ps384 = key
-	p.ps384Opt = opt
+	p.setSignKey(PS384Alg, rsaKeyID(key), func() {
+		p.ps384 = key
+		p.ps384Opt = opt
+	})
 }
 
 func (p *DefaultProvider) SetPS512Key(key *rsa.PrivateKey, opt *rsa.PSSOptions) {
-	p.ps512 = key
-	p.ps512Opt = opt
+	p.setSignKey(PS512Alg, rsaKeyID(key), func() {
+		p.ps512 = key
+		p.ps512Opt = opt
+	})
 }
 
 func (p *DefaultProvider) SetES256Key(key *ecdsa.PrivateKey) {
-	p.es256 = key
+	p.setSignKey(ES256Alg, ecdsaKeyID(key), func() {
+		p.es256 = key
+	})
 }
 
 func (p *DefaultProvider) SetES384Key(key *ecdsa.PrivateKey) {
-	p.es384 = key
+	p.setSignKey(ES384Alg, ecdsaKeyID(key), func() {
+		p.es384 = key
+	})
 }
 
 func (p *DefaultProvider) SetES512Key(key *ecdsa.PrivateKey) {
-	p.es512 = key
+	p.setSignKey(ES512Alg, ecdsaKeyID(key), func() {
+		p.es512 = key
+	})
 }
 
 func (p *DefaultProvider) GenRS256Key() {
-	p.rs256, _ = rsa.GenerateKey(rand.Reader, 2048)
+	key, _ := rsa.GenerateKey(p.config.random(), 2048)
+	p.SetRS256Key(key)
 }
 
 func (p *DefaultProvider) GenRS384Key() {
-	p.rs384, _ = rsa.GenerateKey(rand.Reader, 2048)
+	key, _ := rsa.GenerateKey(p.config.random(), 2048)
+	p.SetRS384Key(key)
 }
 
 func (p *DefaultProvider) GenRS512Key() {
-	p.rs512, _ = rsa.GenerateKey(rand.Reader, 2048)
+	key, _ := rsa.GenerateKey(p.config.random(), 2048)
+	p.SetRS512Key(key)
 }
 
 func (p *DefaultProvider) GenPS256Key() {
-	p.ps256, _ = rsa.GenerateKey(rand.Reader, 2048)
+	key, _ := rsa.GenerateKey(p.config.random(), 2048)
+	p.SetPS256Key(key, p.PS256Opt())
 }
 
 func (p *DefaultProvider) GenPS384Key() {
-	p.ps384, _ = rsa.GenerateKey(rand.Reader, 2048)
+	key, _ := rsa.GenerateKey(p.config.random(), 2048)
+	p.SetPS384Key(key, p.PS384Opt())
 }
 
 func (p *DefaultProvider) GenPS512Key() {
-	p.ps512, _ = rsa.GenerateKey(rand.Reader, 2048)
+	key, _ := rsa.GenerateKey(p.config.random(), 2048)
+	p.SetPS512Key(key, p.PS512Opt())
 }
 
 func (p *DefaultProvider) GenES256Key() {
-	p.es256, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), p.config.random())
+	p.SetES256Key(key)
 }
 
 func (p *DefaultProvider) GenES384Key() {
-	p.es384, _ = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	key, _ := ecdsa.GenerateKey(elliptic.P384(), p.config.random())
+	p.SetES384Key(key)
 }
 
 func (p *DefaultProvider) GenES512Key() {
-	p.es512, _ = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	key, _ := ecdsa.GenerateKey(elliptic.P521(), p.config.random())
+	p.SetES512Key(key)
+}
+
+// jwe的rsa解密私钥
+func (p *DefaultProvider) EncryptionKey() *rsa.PrivateKey {
+	k, _ := p.encryptionKey()
+	return k
+}
+
+// 解密私钥和它的kid
+func (p *DefaultProvider) encryptionKey() (*rsa.PrivateKey, string) {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+	return p.encKey, p.encKID
+}
+
+// 设置jwe的rsa解密私钥，用于RSA-OAEP和RSA-OAEP-256
+func (p *DefaultProvider) SetEncryptionKey(key *rsa.PrivateKey) {
+	kid := ""
+	if key != nil {
+		kid, _ = JKT(&key.PublicKey)
+	}
+	p.keyLock.Lock()
+	p.encKey = key
+	p.encKID = kid
+	p.keyLock.Unlock()
+}
+
+func (p *DefaultProvider) GenEncryptionKey() {
+	key, _ := rsa.GenerateKey(p.config.random(), 2048)
+	p.SetEncryptionKey(key)
+}
+
+// 发送者加密使用的接收者，没有解密私钥返回nil
+func (p *DefaultProvider) Recipient(enc Enc) *Recipient {
+	key, kid := p.encryptionKey()
+	if key == nil {
+		return nil
+	}
+	r := new(Recipient)
+	r.Alg = RSAOAEP256Alg
+	r.Enc = enc
+	r.Key = &key.PublicKey
+	r.KeyID = kid
+	return r
+}
+
+// 实现DecryptionKeyProvider，header.kid不为空必须相同
+func (p *DefaultProvider) DecryptionKey(header Claims) (interface{}, error) {
+	alg, _ := header["alg"].(string)
+	switch Alg(alg) {
+	case RSAOAEPAlg, RSAOAEP256Alg:
+		kid, _ := header["kid"].(string)
+		key, encKID := p.encryptionKey()
+		if key == nil || (kid != "" && kid != encKID) {
+			return nil, ErrKeyNotFound
+		}
+		return key, nil
+	case A128GCMKWAlg, A192GCMKWAlg, A256GCMKWAlg, DirAlg:
+		return p.octets.DecryptionKey(header)
+	}
+	return nil, fmt.Errorf("unsupported algorithm <%s>", alg)
+}
+
+// 配置了私钥的非对称算法
+func (p *DefaultProvider) Algs() []Alg {
+	var algs []Alg
+	for _, a := range []Alg{RS256Alg, RS384Alg, RS512Alg, ES256Alg, ES384Alg, ES512Alg, PS256Alg, PS384Alg, PS512Alg} {
+		if p.publicKey(a) != nil {
+			algs = append(algs, a)
+		}
+	}
+	return algs
+}
+
+// 非对称算法的公钥，包括jwe的加密公钥
+func (p *DefaultProvider) JWKS() *JWKSet {
+	set := new(JWKSet)
+	set.Keys = make([]*JWK, 0)
+	for _, a := range p.Algs() {
+		j, err := NewJWK(p.publicKey(a), a, p.KeyID(a))
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, j)
+	}
+	if key, kid := p.encryptionKey(); key != nil {
+		j, err := NewJWK(&key.PublicKey, RSAOAEP256Alg, kid)
+		if err == nil {
+			j.Use = "enc"
+			set.Keys = append(set.Keys, j)
+		}
+	}
+	return set
+}
+
+// 实现KeyIDProvider，非对称算法默认是公钥的sha256指纹，
+// hs算法只有FileKeyStore设置的key才有kid，没有key返回空
+func (p *DefaultProvider) KeyID(alg Alg) string {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+	return p.kid[alg]
+}
+
+// 在锁内同时设置key和kid，签名验证不会看到key和kid不一致，
+// 设置新的key会清除有效期
+func (p *DefaultProvider) setSignKey(alg Alg, kid string, set func()) {
+	p.keyLock.Lock()
+	set()
+	if kid == "" {
+		delete(p.kid, alg)
+	} else {
+		p.kid[alg] = kid
+	}
+	p.keyLock.Unlock()
+	p.SetKeyLifetime(alg, nil)
+}
+
+// 退役的key，只用于验证grace期间的token
+type retiredKey struct {
+	alg      Alg
+	key      interface{}
+	lifetime *KeyLifetime
+}
+
+// 替换所有退役的key
+func (p *DefaultProvider) setRetiredKeys(keys map[string]*retiredKey) {
+	p.keyLock.Lock()
+	p.retired = keys
+	p.keyLock.Unlock()
+}
+
+// 实现retiredKeyProvider，alg必须相同
+func (p *DefaultProvider) retiredKey(alg Alg, kid string) (interface{}, *KeyLifetime) {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+	k := p.retired[kid]
+	if k == nil || k.alg != alg {
+		return nil, nil
+	}
+	return k.key, k.lifetime
+}
+
+// 私钥的rfc7638指纹，nil返回空
+func rsaKeyID(key *rsa.PrivateKey) string {
+	if key == nil {
+		return ""
+	}
+	kid, _ := JKT(&key.PublicKey)
+	return kid
+}
+
+func ecdsaKeyID(key *ecdsa.PrivateKey) string {
+	if key == nil {
+		return ""
+	}
+	kid, _ := JKT(&key.PublicKey)
+	return kid
+}
+
+// 算法对应的公钥，没有返回nil
+func (p *DefaultProvider) publicKey(alg Alg) crypto.PublicKey {
+	k := p.privateKey(alg)
+	if k == nil {
+		return nil
+	}
+	return k.Public()
+}
+
+// 非对称算法对应的私钥，没有返回nil
+func (p *DefaultProvider) privateKey(alg Alg) crypto.Signer {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+	return p.signer(alg)
+}
+
+// 实现signingKeyProvider，在同一个读锁内得到私钥，pss选项和kid
+func (p *DefaultProvider) signingKey(alg Alg) (crypto.Signer, *rsa.PSSOptions, string) {
+	p.keyLock.RLock()
+	defer p.keyLock.RUnlock()
+	var opt *rsa.PSSOptions
+	switch alg {
+	case PS256Alg:
+		opt = p.ps256Opt
+	case PS384Alg:
+		opt = p.ps384Opt
+	case PS512Alg:
+		opt = p.ps512Opt
+	}
+	return p.signer(alg), opt, p.kid[alg]
+}
+
+// 需要持有keyLock
+func (p *DefaultProvider) signer(alg Alg) crypto.Signer {
+	var rk *rsa.PrivateKey
+	var ek *ecdsa.PrivateKey
+	switch alg {
+	case RS256Alg:
+		rk = p.rs256
+	case RS384Alg:
+		rk = p.rs384
+	case RS512Alg:
+		rk = p.rs512
+	case PS256Alg:
+		rk = p.ps256
+	case PS384Alg:
+		rk = p.ps384
+	case PS512Alg:
+		rk = p.ps512
+	case ES256Alg:
+		ek = p.es256
+	case ES384Alg:
+		ek = p.es384
+	case ES512Alg:
+		ek = p.es512
+	}
+	if rk != nil {
+		return rk
+	}
+	if ek != nil {
+		return ek
+	}
+	return nil
+}
+
+// 所有key的私钥jwk，包括对称key和jwe的解密私钥
+func (p *DefaultProvider) PrivateJWKS() *JWKSet {
+	set := new(JWKSet)
+	set.Keys = make([]*JWK, 0)
+	for _, k := range p.octets.Keys() {
+		j, _ := NewPrivateJWK(k.Secret, k.Alg, k.Kid)
+		switch k.Usage {
+		case KeyUsageSign:
+			j.Use = "sig"
+		case KeyUsageEncrypt:
+			j.Use = "enc"
+		}
+		set.Keys = append(set.Keys, j)
+	}
+	for _, a := range p.Algs() {
+		j, err := NewPrivateJWK(p.privateKey(a), a, p.KeyID(a))
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, j)
+	}
+	if key, kid := p.encryptionKey(); key != nil {
+		j, err := NewPrivateJWK(key, RSAOAEP256Alg, kid)
+		if err == nil {
+			j.Use = "enc"
+			set.Keys = append(set.Keys, j)
+		}
+	}
+	return set
+}
+
+// 导入PrivateJWKS的结果，根据jwk.alg设置对应的key
+func (p *DefaultProvider) ImportJWKS(set *JWKSet) error {
+	for _, j := range set.Keys {
+		k, err := j.PrivateKey()
+		if err != nil {
+			return err
+		}
+		alg := Alg(j.Alg)
+		if b, ok := k.([]byte); ok && (j.Kid != j.Alg || !strings.HasPrefix(j.Alg, "HS")) {
+			// kid选择的对称key
+			o := new(OctetKey)
+			o.Kid = j.Kid
+			o.Alg = alg
+			o.Secret = b
+			o.Usage, err = octetKeyUsage(alg, j.Use)
+			if err != nil {
+				return err
+			}
+			err = p.octets.Add(o)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err = p.setKey(alg, k, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 导入的对称key只能有一种用途，由alg决定，没有alg不能导入，
+// use不为空必须和alg一致
+func octetKeyUsage(alg Alg, use string) (KeyUsage, error) {
+	var usage KeyUsage
+	switch alg {
+	case HS256Alg, HS384Alg, HS512Alg:
+		usage = KeyUsageSign
+	case A128GCMKWAlg, A192GCMKWAlg, A256GCMKWAlg, DirAlg:
+		usage = KeyUsageEncrypt
+	default:
+		return 0, fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+	if (use == "sig" && usage != KeyUsageSign) || (use == "enc" && usage != KeyUsageEncrypt) {
+		return 0, ErrKeyUsage
+	}
+	return usage, nil
+}
+
+// 根据算法设置key，kid为空时非对称算法使用公钥的指纹，hs算法没有kid
+func (p *DefaultProvider) setKey(alg Alg, k interface{}, kid string) error {
+	switch alg {
+	case HS256Alg, HS384Alg, HS512Alg:
+		b, ok := k.([]byte)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		p.setSignKey(alg, kid, func() {
+			p.setHSKey(alg, string(b))
+		})
+	case RSAOAEP256Alg:
+		rk, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		p.SetEncryptionKey(rk)
+	case RS256Alg, RS384Alg, RS512Alg, PS256Alg, PS384Alg, PS512Alg:
+		rk, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		if kid == "" {
+			kid = rsaKeyID(rk)
+		}
+		p.setSignKey(alg, kid, func() {
+			switch alg {
+			case RS256Alg:
+				p.rs256 = rk
+			case RS384Alg:
+				p.rs384 = rk
+			case RS512Alg:
+				p.rs512 = rk
+			case PS256Alg:
+				p.ps256 = rk
+			case PS384Alg:
+				p.ps384 = rk
+			default:
+				p.ps512 = rk
+			}
+		})
+	case ES256Alg, ES384Alg, ES512Alg:
+		ek, ok := k.(*ecdsa.PrivateKey)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		if crv, _ := curveName(ek.Curve); crv != curveOfAlg(alg) {
+			return ErrUnsupportedKey
+		}
+		if kid == "" {
+			kid = ecdsaKeyID(ek)
+		}
+		p.setSignKey(alg, kid, func() {
+			switch alg {
+			case ES256Alg:
+				p.es256 = ek
+			case ES384Alg:
+				p.es384 = ek
+			default:
+				p.es512 = ek
+			}
+		})
+	default:
+		return fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+	return nil
+}
+
+// 使用口令导出所有的key，PBES2-HS512+A256KW和A256GCM，
+// count是0使用PBES2DefaultCount
+func (p *DefaultProvider) ExportKeys(password string, count int) (string, error) {
+	r := new(Recipient)
+	r.Alg = PBES2HS512A256KWAlg
+	r.Enc = A256GCMEnc
+	r.Key = password
+	r.P2C = count
+	return EncryptJWKSet(p.PrivateJWKS(), r, p.config)
+}
+
+// 导入ExportKeys的结果
+func (p *DefaultProvider) ImportKeys(token, password string) error {
+	set, err := DecryptJWKSet(token, func(header Claims) (interface{}, error) {
+		alg, _ := header["alg"].(string)
+		if !strings.HasPrefix(alg, "PBES2-") {
+			return nil, ErrUnsupportedAlg
+		}
+		return password, nil
+	}, p.config)
+	if err != nil {
+		return err
+	}
+	return p.ImportJWKS(set)
+}
+
+// 设置alg的key的有效期，nil表示不限制，
+// 设置新的key会清除有效期，所以要在设置key之后调用
+func (p *DefaultProvider) SetKeyLifetime(alg Alg, lifetime *KeyLifetime) {
+	p.ltLock.Lock()
+	if lifetime == nil {
+		delete(p.lifetime, alg)
+	} else {
+		p.lifetime[alg] = lifetime
+	}
+	p.ltLock.Unlock()
+}
+
+// 实现KeyLifetimeProvider
+func (p *DefaultProvider) KeyLifetime(alg Alg) *KeyLifetime {
+	p.ltLock.RLock()
+	l := p.lifetime[alg]
+	p.ltLock.RUnlock()
+	return l
+}
+
+// 吊销alg当前的key，马上不能签名和验证，设置新的key之后恢复
+func (p *DefaultProvider) RevokeKey(alg Alg) {
+	l := new(KeyLifetime)
+	if o := p.KeyLifetime(alg); o != nil {
+		*l = *o
+	}
+	l.Revoked = true
+	p.SetKeyLifetime(alg, l)
+}
+
+// key是否alg当前的key，hs算法是[]byte，其他是私钥
+func (p *DefaultProvider) hasKey(alg Alg, key interface{}) bool {
+	if b, ok := key.([]byte); ok {
+		k := p.octets.Get(string(alg))
+		return k != nil && k.Alg == alg && hmac.Equal(k.Secret, b)
+	}
+	k, ok := key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	pub, ok := p.publicKey(alg).(interface{ Equal(crypto.PublicKey) bool })
+	return ok && pub.Equal(k.Public())
 }
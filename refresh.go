@@ -0,0 +1,277 @@
+package jwt
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+const (
+	refreshTokenTyp        = "refresh+jwt"   // 刷新token的header.typ
+	DefaultRefreshAudience = "refresh_token" // 刷新token默认的aud
+)
+
+// 刷新token家族的存储，一个家族是一次登录产生的所有刷新token
+type RefreshStore interface {
+	// 创建家族，jti是家族当前有效的刷新token
+	CreateFamily(family, jti string, exp time.Time) error
+	// 轮换，jti不是家族当前的刷新token，返回ErrRefreshTokenReused，
+	// 家族不存在或者已经吊销，返回ErrTokenRevoked
+	Rotate(family, jti, newJTI string, exp time.Time) error
+	// 吊销家族
+	RevokeFamily(family string) error
+}
+
+// 一对token
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // access token的有效秒数
+}
+
+func NewRefreshManager(provider Provider, store RefreshStore, alg Alg) *RefreshManager {
+	m := new(RefreshManager)
+	m.Provider = provider
+	m.Store = store
+	m.Alg = alg
+	m.AccessTTL = 15 * time.Minute
+	m.RefreshTTL = 30 * 24 * time.Hour
+	m.RefreshAudience = DefaultRefreshAudience
+	return m
+}
+
+// 签发access/refresh，每次刷新都轮换refresh，
+// 已经轮换过的refresh再次使用，吊销整个家族，
+// refresh的aud是RefreshAudience，检查aud的验证不会把它当成access token，
+// Verify不检查aud，access token使用VerifyAccess验证
+type RefreshManager struct {
+	Provider        Provider      // 签名和验证
+	Store           RefreshStore  // 家族存储
+	Alg             Alg           // 签名算法
+	AccessTTL       time.Duration // access token有效期
+	RefreshTTL      time.Duration // refresh token有效期
+	Audience        string        // access token的aud，空不设置
+	RefreshAudience string        // refresh token的aud，不能为空，不能和Audience相同
+}
+
+// 登录，创建新的家族，claims是access token额外的字段
+func (m *RefreshManager) Issue(sub string, claims Claims) (*TokenPair, error) {
+	if m.RefreshAudience == "" || m.RefreshAudience == m.Audience {
+		return nil, ErrInvalidAudience
+	}
+	family, err := newJTI(configOf(m.Provider).random())
+	if err != nil {
+		return nil, err
+	}
+	refresh, jti, exp, err := m.signRefresh(sub, family, claims)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Store.CreateFamily(family, jti, exp)
+	if err != nil {
+		return nil, err
+	}
+	return m.pair(sub, claims, refresh)
+}
+
+// 使用refresh换取新的一对token
+func (m *RefreshManager) Refresh(refreshToken string) (*TokenPair, error) {
+	header, payload, err := Verify(refreshToken, m.Provider)
+	if err != nil {
+		return nil, err
+	}
+	if !m.isRefresh(header, payload) {
+		return nil, ErrInvalidToken
+	}
+	sub, _ := payload["sub"].(string)
+	family, _ := payload["fam"].(string)
+	jti, _ := payload["jti"].(string)
+	if family == "" || jti == "" {
+		return nil, ErrInvalidToken
+	}
+	claims, _ := payload["ext"].(map[string]interface{})
+	refresh, newJTI, exp, err := m.signRefresh(sub, family, claims)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Store.Rotate(family, jti, newJTI, exp)
+	if err != nil {
+		if err == ErrRefreshTokenReused {
+			// 可能被盗用，整个家族作废
+			_ = m.Store.RevokeFamily(family)
+		}
+		return nil, err
+	}
+	return m.pair(sub, claims, refresh)
+}
+
+// 退出登录，吊销refresh所在的家族
+func (m *RefreshManager) Revoke(refreshToken string) error {
+	header, payload, err := Verify(refreshToken, m.Provider)
+	if err != nil {
+		return err
+	}
+	family, _ := payload["fam"].(string)
+	if !m.isRefresh(header, payload) || family == "" {
+		return ErrInvalidToken
+	}
+	return m.Store.RevokeFamily(family)
+}
+
+// 验证access token，refresh token会被拒绝，Audience不为空，aud必须包含它
+func (m *RefreshManager) VerifyAccess(accessToken string) (header, payload Claims, err error) {
+	header, payload, err = Verify(accessToken, m.Provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header["typ"] == refreshTokenTyp {
+		return nil, nil, ErrInvalidTokenType
+	}
+	aud := claimStrings(payload, "aud")
+	if containsString(aud, m.RefreshAudience) {
+		return nil, nil, ErrInvalidAudience
+	}
+	if m.Audience != "" && !containsString(aud, m.Audience) {
+		return nil, nil, ErrInvalidAudience
+	}
+	return
+}
+
+// typ是refresh+jwt，aud是RefreshAudience
+func (m *RefreshManager) isRefresh(header, payload Claims) bool {
+	return header["typ"] == refreshTokenTyp &&
+		m.RefreshAudience != "" &&
+		containsString(claimStrings(payload, "aud"), m.RefreshAudience)
+}
+
+func (m *RefreshManager) signRefresh(sub, family string, claims Claims) (token, jti string, exp time.Time, err error) {
+	config := configOf(m.Provider)
+	jti, err = newJTI(config.random())
+	if err != nil {
+		return
+	}
+	exp = config.now().Add(m.RefreshTTL)
+	header := make(Claims)
+	header["typ"] = refreshTokenTyp
+	payload := make(Claims)
+	payload["sub"] = sub
+	payload["fam"] = family
+	payload["aud"] = []string{m.RefreshAudience}
+	payload["jti"] = jti
+	payload["exp"] = exp.Unix()
+	if len(claims) > 0 {
+		payload["ext"] = claims
+	}
+	token, err = Sign(m.Alg, header, payload, m.Provider)
+	return
+}
+
+func (m *RefreshManager) pair(sub string, claims Claims, refresh string) (*TokenPair, error) {
+	payload := make(Claims)
+	for k, v := range claims {
+		payload[k] = v
+	}
+	payload["sub"] = sub
+	if m.Audience != "" {
+		payload["aud"] = []string{m.Audience}
+	}
+	payload["exp"] = configOf(m.Provider).now().Add(m.AccessTTL).Unix()
+	access, err := Sign(m.Alg, make(Claims), payload, m.Provider)
+	if err != nil {
+		return nil, err
+	}
+	p := new(TokenPair)
+	p.AccessToken = access
+	p.RefreshToken = refresh
+	p.ExpiresIn = int64(m.AccessTTL / time.Second)
+	return p, nil
+}
+
+func NewMemoryRefreshStore(clock Clock) *MemoryRefreshStore {
+	s := new(MemoryRefreshStore)
+	s.clock = clock
+	s.family = make(map[string]*refreshFamily)
+	s.CompactInterval = defaultCompactInterval
+	return s
+}
+
+// 内存家族存储，过期的家族按照CompactInterval清理
+type MemoryRefreshStore struct {
+	CompactInterval time.Duration             // 清理间隔
+	clock           Clock                     // 时间来源
+	lock            sync.Mutex                // 同步锁
+	family          map[string]*refreshFamily // 家族
+	compactTime     time.Time                 // 上一次清理的时间
+}
+
+type refreshFamily struct {
+	jti     string    // 当前有效的刷新token
+	exp     time.Time // 当前刷新token的过期时间
+	revoked bool      // 已经吊销
+}
+
+func (s *MemoryRefreshStore) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+func (s *MemoryRefreshStore) CreateFamily(family, jti string, exp time.Time) error {
+	now := s.now()
+	s.lock.Lock()
+	s.family[family] = &refreshFamily{jti: jti, exp: exp}
+	// 不是每次登录都清理
+	if now.Sub(s.compactTime) >= s.CompactInterval {
+		s.compact(now)
+	}
+	s.lock.Unlock()
+	return nil
+}
+
+// 数量
+func (s *MemoryRefreshStore) Len() int {
+	s.lock.Lock()
+	n := len(s.family)
+	s.lock.Unlock()
+	return n
+}
+
+// 清理过期的家族
+func (s *MemoryRefreshStore) compact(now time.Time) {
+	for k, v := range s.family {
+		if now.After(v.exp) {
+			delete(s.family, k)
+		}
+	}
+	s.compactTime = now
+}
+
+func (s *MemoryRefreshStore) Rotate(family, jti, newJTI string, exp time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, ok := s.family[family]
+	if !ok || f.revoked {
+		return ErrTokenRevoked
+	}
+	if f.jti != jti {
+		return ErrRefreshTokenReused
+	}
+	f.jti = newJTI
+	f.exp = exp
+	return nil
+}
+
+func (s *MemoryRefreshStore) RevokeFamily(family string) error {
+	s.lock.Lock()
+	if f, ok := s.family[family]; ok {
+		// 保留记录直到过期，再次使用能识别出来
+		f.revoked = true
+	}
+	s.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,88 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+)
+
+// 测试刷新token轮换和重复使用检测
+func Test_RefreshManager(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	m := NewRefreshManager(pro, NewMemoryRefreshStore(nil), HS256Alg)
+	claims := make(Claims)
+	claims["role"] = "admin"
+	pair1, err := m.Issue("user", claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p, err := Verify(pair1.AccessToken, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p["sub"] != "user" || p["role"] != "admin" {
+		t.FailNow()
+	}
+	// access token不能用来刷新
+	_, err = m.Refresh(pair1.AccessToken)
+	if err != ErrInvalidToken {
+		t.Fatal(err)
+	}
+	// refresh token不能当成access token
+	_, _, err = m.VerifyAccess(pair1.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = m.VerifyAccess(pair1.RefreshToken)
+	if err != ErrInvalidTokenType {
+		t.Fatal(err)
+	}
+	_, p, err = Verify(pair1.RefreshToken, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(claimStrings(p, "aud"), DefaultRefreshAudience) {
+		t.FailNow()
+	}
+	pair2, err := m.Refresh(pair1.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p, err = Verify(pair2.AccessToken, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p["role"] != "admin" {
+		t.FailNow()
+	}
+	// 重复使用旧的refresh，整个家族作废
+	_, err = m.Refresh(pair1.RefreshToken)
+	if err != ErrRefreshTokenReused {
+		t.Fatal(err)
+	}
+	_, err = m.Refresh(pair2.RefreshToken)
+	if err != ErrTokenRevoked {
+		t.Fatal(err)
+	}
+}
+
+// 测试过期家族的清理
+func Test_MemoryRefreshStore(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	s := NewMemoryRefreshStore(ClockFunc(func() time.Time { return now }))
+	_ = s.CreateFamily("f1", "1", now.Add(time.Second))
+	_ = s.CreateFamily("f2", "2", now.Add(time.Hour))
+	now = now.Add(s.CompactInterval / 2)
+	// 还没有到清理间隔
+	_ = s.CreateFamily("f3", "3", now.Add(time.Hour))
+	if s.Len() != 3 {
+		t.FailNow()
+	}
+	now = now.Add(s.CompactInterval)
+	_ = s.CreateFamily("f4", "4", now.Add(time.Hour))
+	if s.Len() != 3 {
+		t.Fatal(s.Len())
+	}
+	if s.Rotate("f1", "1", "5", now) != ErrTokenRevoked {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,321 @@
+package jwt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTokenRevoked = errors.New("token is revoked")
+)
+
+// jti吊销列表，Config.Revocation不为nil时，验证会检查payload的jti
+type RevocationStore interface {
+	// 吊销jti，exp之后不再需要保存，exp是零值表示永久
+	Revoke(jti string, exp time.Time) error
+	// jti是否已经吊销
+	IsRevoked(jti string) (bool, error)
+}
+
+// 吊销payload的jti，保存到exp加上config.Leeway，config是nil使用DefaultConfig
+func RevokePayload(store RevocationStore, payload Claims, config *Config) error {
+	jti, ok := payload["jti"].(string)
+	if !ok || jti == "" {
+		return ErrInvalidToken
+	}
+	if config == nil {
+		config = DefaultConfig
+	}
+	return store.Revoke(jti, payloadExpiry(payload, config))
+}
+
+// Verify在exp加上Leeway之前都会接受token，吊销和使用的记录要保存到这个时间，
+// 没有exp返回零值
+func payloadExpiry(payload Claims, config *Config) time.Time {
+	n, ok := claimInt64(payload, "exp")
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(n, 0).Add(config.Leeway)
+}
+
+// 检查payload的jti是否已经吊销
+func checkRevoked(store RevocationStore, payload Claims) error {
+	if store == nil {
+		return nil
+	}
+	jti, ok := payload["jti"].(string)
+	if !ok {
+		return nil
+	}
+	revoked, err := store.IsRevoked(jti)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+const (
+	defaultCompactInterval = time.Minute // 默认的清理间隔
+	minRewriteLines        = 1024        // 文件记录少于这个数不重写
+)
+
+func NewMemoryRevocationStore(clock Clock) *MemoryRevocationStore {
+	s := new(MemoryRevocationStore)
+	s.clock = clock
+	s.jti = make(map[string]time.Time)
+	s.CompactInterval = defaultCompactInterval
+	return s
+}
+
+// 内存吊销列表，过期的jti会被自动清理
+type MemoryRevocationStore struct {
+	CompactInterval time.Duration        // 清理间隔
+	clock           Clock                // 时间来源
+	lock            sync.Mutex           // 同步锁
+	jti             map[string]time.Time // jti -> exp
+	compactTime     time.Time            // 上一次清理的时间
+}
+
+func (s *MemoryRevocationStore) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+func (s *MemoryRevocationStore) Revoke(jti string, exp time.Time) error {
+	now := s.now()
+	s.lock.Lock()
+	s.jti[jti] = exp
+	s.compactIfNeed(now)
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	now := s.now()
+	s.lock.Lock()
+	ok := s.exists(jti, now)
+	s.compactIfNeed(now)
+	s.lock.Unlock()
+	return ok, nil
+}
+
+// 实现ConsumeStore，jti已经存在返回false
+func (s *MemoryRevocationStore) Consume(jti string, exp time.Time) (bool, error) {
+	now := s.now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.exists(jti, now) {
+		return false, nil
+	}
+	s.jti[jti] = exp
+	s.compactIfNeed(now)
+	return true, nil
+}
+
+// jti存在并且没有过期
+func (s *MemoryRevocationStore) exists(jti string, now time.Time) bool {
+	exp, ok := s.jti[jti]
+	if ok && !exp.IsZero() && now.After(exp) {
+		delete(s.jti, jti)
+		return false
+	}
+	return ok
+}
+
+// 数量
+func (s *MemoryRevocationStore) Len() int {
+	s.lock.Lock()
+	n := len(s.jti)
+	s.lock.Unlock()
+	return n
+}
+
+// 清理过期的jti
+func (s *MemoryRevocationStore) Compact() {
+	now := s.now()
+	s.lock.Lock()
+	s.compact(now)
+	s.lock.Unlock()
+}
+
+func (s *MemoryRevocationStore) compactIfNeed(now time.Time) {
+	if now.Sub(s.compactTime) >= s.CompactInterval {
+		s.compact(now)
+	}
+}
+
+func (s *MemoryRevocationStore) compact(now time.Time) {
+	for k, v := range s.jti {
+		if !v.IsZero() && now.After(v) {
+			delete(s.jti, k)
+		}
+	}
+	s.compactTime = now
+}
+
+// 打开文件，加载之前的记录
+func NewFileRevocationStore(path string, clock Clock) (*FileRevocationStore, error) {
+	s := new(FileRevocationStore)
+	s.MemoryRevocationStore = NewMemoryRevocationStore(clock)
+	s.path = path
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	// 加载时顺便清理
+	err = s.rewrite()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// 文件吊销列表，只追加写入，每一行是"exp jti"，
+// 重启之后可以恢复，过期的记录达到一定数量会重写文件
+type FileRevocationStore struct {
+	*MemoryRevocationStore
+	path  string   // 文件路径
+	file  *os.File // 追加写入的文件
+	lines int      // 文件中的记录数，包括已经过期的
+}
+
+func (s *FileRevocationStore) load() error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(line[:i], 10, 64)
+		if err != nil {
+			continue
+		}
+		var exp time.Time
+		if n != 0 {
+			exp = time.Unix(n, 0)
+		}
+		s.jti[line[i+1:]] = exp
+	}
+	return scanner.Err()
+}
+
+// 只写入未过期的记录
+func (s *FileRevocationStore) rewrite() error {
+	s.compact(s.now())
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for k, v := range s.jti {
+		writeRevocationLine(w, k, v)
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	s.lines = len(s.jti)
+	return err
+}
+
+func writeRevocationLine(w *bufio.Writer, jti string, exp time.Time) {
+	var n int64
+	if !exp.IsZero() {
+		n = exp.Unix()
+	}
+	fmt.Fprintf(w, "%d %s\n", n, jti)
+}
+
+func (s *FileRevocationStore) Revoke(jti string, exp time.Time) error {
+	if strings.ContainsAny(jti, "\r\n") {
+		return ErrInvalidToken
+	}
+	now := s.now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.append(jti, exp, now)
+}
+
+// 实现ConsumeStore，jti已经存在返回false
+func (s *FileRevocationStore) Consume(jti string, exp time.Time) (bool, error) {
+	if strings.ContainsAny(jti, "\r\n") {
+		return false, ErrInvalidToken
+	}
+	now := s.now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.exists(jti, now) {
+		return false, nil
+	}
+	return true, s.append(jti, exp, now)
+}
+
+// 写入文件和内存
+func (s *FileRevocationStore) append(jti string, exp time.Time, now time.Time) error {
+	w := bufio.NewWriter(s.file)
+	writeRevocationLine(w, jti, exp)
+	err := w.Flush()
+	if err != nil {
+		return err
+	}
+	s.jti[jti] = exp
+	s.lines++
+	s.compactIfNeed(now)
+	// 文件中过期的记录比有效的多就重写
+	if s.lines > minRewriteLines && s.lines > 2*len(s.jti) {
+		return s.rewrite()
+	}
+	return nil
+}
+
+// 立即清理内存和文件
+func (s *FileRevocationStore) Compact() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.rewrite()
+}
+
+func (s *FileRevocationStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,134 @@
+package jwt
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 测试吊销之后验证失败
+func Test_Revocation(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	clock := ClockFunc(func() time.Time { return now })
+	store := NewMemoryRevocationStore(clock)
+	config := &Config{Clock: clock, Revocation: store}
+	pro := NewDefaultProviderWithConfig(config, "hs256", "hs384", "hs512")
+	payload := NewPayload()
+	payload.SetEXPAt(now.Add(time.Hour))
+	token, err := Sign(HS256Alg, make(Claims), Claims(payload), pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, p, err := Verify(token, pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = RevokePayload(store, p, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = Verify(token, pro)
+	if err != ErrTokenRevoked {
+		t.Fatal(err)
+	}
+	// exp之后还在Leeway内，仍然是吊销的
+	config.Leeway = time.Minute
+	leeway, _ := Sign(HS256Alg, make(Claims), Claims{"exp": now.Add(time.Second).Unix()}, pro)
+	_, p, _ = Verify(leeway, pro)
+	err = RevokePayload(store, p, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	store.Compact()
+	_, _, err = Verify(leeway, pro)
+	if err != ErrTokenRevoked {
+		t.Fatal(err)
+	}
+	// 过期之后自动清理
+	now = now.Add(2 * time.Hour)
+	store.Compact()
+	if store.Len() != 0 {
+		t.FailNow()
+	}
+}
+
+// 测试文件吊销列表重新打开之后恢复
+func Test_FileRevocationStore(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	clock := ClockFunc(func() time.Time { return now })
+	path := filepath.Join(t.TempDir(), "revoked")
+	store, err := NewFileRevocationStore(path, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Revoke("a", now.Add(time.Hour))
+	_ = store.Revoke("b", now.Add(3*time.Hour))
+	_ = store.Revoke("c", time.Time{})
+	_ = store.Close()
+	// 重新打开，a已经过期
+	now = now.Add(2 * time.Hour)
+	store, err = NewFileRevocationStore(path, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, jti := range []string{"b", "c"} {
+		ok, _ := store.IsRevoked(jti)
+		if !ok {
+			t.Fatal(jti)
+		}
+	}
+	ok, _ := store.IsRevoked("a")
+	if ok || store.Len() != 2 {
+		t.FailNow()
+	}
+}
+
+// 测试并发验证一次性token，只有一个成功
+func Test_VerifyOnce(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	store := NewMemoryRevocationStore(nil)
+	payload := NewPayload()
+	payload.SetEXP(time.Hour)
+	token, err := Sign(HS256Alg, make(Claims), Claims(payload), pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ok, consumed int32
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			_, _, err := VerifyOnce(token, pro, store)
+			if err == nil {
+				atomic.AddInt32(&ok, 1)
+			} else if err == ErrTokenConsumed {
+				atomic.AddInt32(&consumed, 1)
+			}
+		}()
+	}
+	wait.Wait()
+	if ok != 1 || consumed != 9 {
+		t.Fatal(ok, consumed)
+	}
+	// exp之后还在Leeway内，不能重放
+	now := time.Unix(1600000000, 0)
+	clock := ClockFunc(func() time.Time { return now })
+	pro = NewDefaultProviderWithConfig(&Config{Clock: clock, Leeway: time.Minute}, "hs256", "", "")
+	store = NewMemoryRevocationStore(clock)
+	token, _ = Sign(HS256Alg, make(Claims), Claims{"exp": now.Add(time.Second).Unix()}, pro)
+	_, _, err = VerifyOnce(token, pro, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	store.Compact()
+	_, _, err = VerifyOnce(token, pro, store)
+	if err != ErrTokenConsumed {
+		t.Fatal(err)
+	}
+}
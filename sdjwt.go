@@ -0,0 +1,526 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// selective disclosure jwt，只支持sha-256
+
+const (
+	KBJWTTyp = "kb+jwt" // key binding jwt的header.typ
+	sdAlg    = "sha-256"
+)
+
+var (
+	ErrInvalidDisclosure = errors.New("invalid disclosure")
+	ErrInvalidKeyBinding = errors.New("invalid key binding jwt")
+)
+
+// 标记为可以选择性披露的值
+type sdValue struct {
+	value interface{}
+}
+
+// 签发时，payload中使用SD包装的值会变成披露，
+// 可以是对象的成员，也可以是数组的元素，可以嵌套
+func SD(value interface{}) interface{} {
+	return &sdValue{value: value}
+}
+
+// 一个披露，数组元素的Name为空
+type Disclosure struct {
+	Salt    string
+	Name    string
+	Value   interface{}
+	Encoded string // base64(json([salt,name,value]))
+}
+
+func newDisclosure(salt, name string, value interface{}) (*Disclosure, error) {
+	d := new(Disclosure)
+	d.Salt = salt
+	d.Name = name
+	d.Value = value
+	a := []interface{}{salt, name, value}
+	if name == "" {
+		a = []interface{}{salt, value}
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	d.Encoded = base64.RawURLEncoding.EncodeToString(data)
+	return d, nil
+}
+
+// 解析base64编码的披露
+func parseDisclosure(s string) (*Disclosure, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidDisclosure
+	}
+	var a []interface{}
+	err = json.Unmarshal(data, &a)
+	if err != nil {
+		return nil, ErrInvalidDisclosure
+	}
+	d := new(Disclosure)
+	d.Encoded = s
+	var ok bool
+	switch len(a) {
+	case 2:
+		d.Value = a[1]
+	case 3:
+		d.Name, ok = a[1].(string)
+		if !ok || d.Name == "" || d.Name == "_sd" || d.Name == "..." {
+			return nil, ErrInvalidDisclosure
+		}
+		d.Value = a[2]
+	default:
+		return nil, ErrInvalidDisclosure
+	}
+	d.Salt, ok = a[0].(string)
+	if !ok {
+		return nil, ErrInvalidDisclosure
+	}
+	return d, nil
+}
+
+// base64(sha256(Encoded))
+func (d *Disclosure) Digest() string {
+	sum := sha256.Sum256([]byte(d.Encoded))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// 签发sd-jwt，返回"jws~d1~d2~...~"和所有的披露，
+// payload中的SD值替换成_sd或者{"...":digest}
+func IssueSDJWT(alg Alg, header, payload Claims, provider Provider) (string, []*Disclosure, error) {
+	config := configOf(provider)
+	var disclosures []*Disclosure
+	var conceal func(v interface{}) (interface{}, error)
+	// 生成披露，返回它的digest
+	disclose := func(name string, v interface{}) (string, error) {
+		v, err := conceal(v)
+		if err != nil {
+			return "", err
+		}
+		salt, err := newJTI(config.random())
+		if err != nil {
+			return "", err
+		}
+		d, err := newDisclosure(salt, name, v)
+		if err != nil {
+			return "", err
+		}
+		disclosures = append(disclosures, d)
+		return d.Digest(), nil
+	}
+	concealMap := func(m map[string]interface{}) (map[string]interface{}, error) {
+		names := make([]string, 0, len(m))
+		for k := range m {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		o := make(map[string]interface{})
+		var sds []string
+		for _, k := range names {
+			if s, ok := m[k].(*sdValue); ok {
+				if k == "_sd" || k == "..." {
+					return nil, ErrInvalidDisclosure
+				}
+				digest, err := disclose(k, s.value)
+				if err != nil {
+					return nil, err
+				}
+				sds = append(sds, digest)
+				continue
+			}
+			v, err := conceal(m[k])
+			if err != nil {
+				return nil, err
+			}
+			o[k] = v
+		}
+		if len(sds) > 0 {
+			sort.Strings(sds)
+			o["_sd"] = sds
+		}
+		return o, nil
+	}
+	conceal = func(v interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case Claims:
+			return concealMap(v)
+		case Payload:
+			return concealMap(v)
+		case map[string]interface{}:
+			return concealMap(v)
+		case []interface{}:
+			a := make([]interface{}, 0, len(v))
+			for _, e := range v {
+				if s, ok := e.(*sdValue); ok {
+					digest, err := disclose("", s.value)
+					if err != nil {
+						return nil, err
+					}
+					a = append(a, map[string]interface{}{"...": digest})
+					continue
+				}
+				e, err := conceal(e)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, e)
+			}
+			return a, nil
+		case *sdValue:
+			return nil, ErrInvalidDisclosure
+		}
+		return v, nil
+	}
+	m, err := concealMap(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	m["_sd_alg"] = sdAlg
+	token, err := Sign(alg, header, Claims(m), provider)
+	if err != nil {
+		return "", nil, err
+	}
+	s := new(SDJWT)
+	s.Token = token
+	s.Disclosures = disclosures
+	return s.String(), disclosures, nil
+}
+
+// "jws~d1~d2~...~kb"的结构
+type SDJWT struct {
+	Token       string // 签发者的jws
+	Disclosures []*Disclosure
+	KeyBinding  string // kb-jwt，可以为空
+}
+
+// 解析sd-jwt，不验证
+func ParseSDJWT(s string) (*SDJWT, error) {
+	part := strings.Split(s, "~")
+	if len(part) < 2 || part[0] == "" {
+		return nil, ErrInvalidToken
+	}
+	t := new(SDJWT)
+	t.Token = part[0]
+	for _, p := range part[1 : len(part)-1] {
+		d, err := parseDisclosure(p)
+		if err != nil {
+			return nil, err
+		}
+		t.Disclosures = append(t.Disclosures, d)
+	}
+	t.KeyBinding = part[len(part)-1]
+	return t, nil
+}
+
+// 没有kb-jwt的部分，kb-jwt的sd_hash使用它
+func (t *SDJWT) unbound() string {
+	var str strings.Builder
+	str.WriteString(t.Token)
+	str.WriteByte('~')
+	for _, d := range t.Disclosures {
+		str.WriteString(d.Encoded)
+		str.WriteByte('~')
+	}
+	return str.String()
+}
+
+func (t *SDJWT) String() string {
+	return t.unbound() + t.KeyBinding
+}
+
+// 持有者选择需要披露的部分，返回新的SDJWT，
+// 嵌套的披露会自动带上它的上级
+func (t *SDJWT) Select(keep func(d *Disclosure) bool) *SDJWT {
+	n := new(SDJWT)
+	n.Token = t.Token
+	selected := make(map[string]bool)
+	for _, d := range t.Disclosures {
+		if keep(d) {
+			selected[d.Digest()] = true
+		}
+	}
+	// 上级包含了已选择的digest
+	for changed := true; changed; {
+		changed = false
+		for _, d := range t.Disclosures {
+			digest := d.Digest()
+			if selected[digest] {
+				continue
+			}
+			for _, s := range embeddedDigests(d.Value) {
+				if selected[s] {
+					selected[digest] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	for _, d := range t.Disclosures {
+		if selected[d.Digest()] {
+			n.Disclosures = append(n.Disclosures, d)
+		}
+	}
+	return n
+}
+
+// value中的_sd和{"...":digest}
+func embeddedDigests(v interface{}) []string {
+	var digests []string
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			switch k {
+			case "_sd":
+				switch a := e.(type) {
+				case []string:
+					digests = append(digests, a...)
+				case []interface{}:
+					for _, s := range a {
+						if s, ok := s.(string); ok {
+							digests = append(digests, s)
+						}
+					}
+				}
+			case "...":
+				if s, ok := e.(string); ok {
+					digests = append(digests, s)
+				}
+			default:
+				digests = append(digests, embeddedDigests(e)...)
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			digests = append(digests, embeddedDigests(e)...)
+		}
+	}
+	return digests
+}
+
+// 添加kb-jwt，key是payload.cnf.jwk对应的私钥
+func (t *SDJWT) BindKey(alg Alg, key crypto.Signer, aud, nonce string, config *Config) error {
+	if config == nil {
+		config = DefaultConfig
+	}
+	header := make(Claims)
+	header["typ"] = KBJWTTyp
+	payload := make(Claims)
+	payload["iat"] = config.now().Unix()
+	payload["aud"] = aud
+	payload["nonce"] = nonce
+	payload["sd_hash"] = accessTokenHash(t.unbound())
+	kb, err := SignWithKey(alg, header, payload, key, config)
+	if err != nil {
+		return err
+	}
+	t.KeyBinding = kb
+	return nil
+}
+
+func NewSDJWTVerifier(provider Provider) *SDJWTVerifier {
+	v := new(SDJWTVerifier)
+	v.Provider = provider
+	v.KBMaxAge = 5 * time.Minute
+	return v
+}
+
+// 验证sd-jwt
+type SDJWTVerifier struct {
+	Provider Provider      // 验证签发者的签名
+	KeyFunc  KeyFunc       // 不为nil代替Provider
+	Config   *Config       // KeyFunc和kb-jwt使用，nil使用DefaultConfig
+	KBMaxAge time.Duration // kb-jwt的iat和当前时间允许的差距
+}
+
+// 验证签名和披露，返回还原之后的payload，
+// aud或者nonce不为空时必须有kb-jwt
+func (v *SDJWTVerifier) Verify(presentation, aud, nonce string) (header, payload Claims, err error) {
+	t, err := ParseSDJWT(presentation)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v.KeyFunc != nil {
+		header, payload, err = VerifyWithKeyFunc(t.Token, v.KeyFunc, v.Config)
+	} else {
+		header, payload, err = Verify(t.Token, v.Provider)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if alg, ok := payload["_sd_alg"]; ok && alg != sdAlg {
+		return nil, nil, ErrInvalidDisclosure
+	}
+	// kb-jwt使用的是签发者payload中的cnf
+	if t.KeyBinding != "" || aud != "" || nonce != "" {
+		err = v.verifyKeyBinding(t, payload, aud, nonce)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	disclosures := make(map[string]*Disclosure)
+	for _, d := range t.Disclosures {
+		digest := d.Digest()
+		if _, ok := disclosures[digest]; ok {
+			return nil, nil, ErrInvalidDisclosure
+		}
+		disclosures[digest] = d
+	}
+	used := make(map[string]bool)
+	value, err := reveal(map[string]interface{}(payload), disclosures, used)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 每一个披露都必须被引用
+	if len(used) != len(disclosures) {
+		return nil, nil, ErrInvalidDisclosure
+	}
+	payload = Claims(value.(map[string]interface{}))
+	delete(payload, "_sd_alg")
+	return header, payload, nil
+}
+
+// 使用披露还原v
+func reveal(v interface{}, disclosures map[string]*Disclosure, used map[string]bool) (interface{}, error) {
+	use := func(digest string) (*Disclosure, error) {
+		d, ok := disclosures[digest]
+		if !ok {
+			// 没有披露，或者是诱饵
+			return nil, nil
+		}
+		if used[digest] {
+			return nil, ErrInvalidDisclosure
+		}
+		used[digest] = true
+		return d, nil
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		o := make(map[string]interface{})
+		for k, e := range v {
+			if k == "_sd" {
+				continue
+			}
+			e, err := reveal(e, disclosures, used)
+			if err != nil {
+				return nil, err
+			}
+			o[k] = e
+		}
+		if _, ok := v["_sd"]; ok {
+			a, ok := v["_sd"].([]interface{})
+			if !ok {
+				return nil, ErrInvalidDisclosure
+			}
+			for _, s := range a {
+				digest, ok := s.(string)
+				if !ok {
+					return nil, ErrInvalidDisclosure
+				}
+				d, err := use(digest)
+				if err != nil {
+					return nil, err
+				}
+				if d == nil {
+					continue
+				}
+				if _, ok = o[d.Name]; ok || d.Name == "" {
+					return nil, ErrInvalidDisclosure
+				}
+				o[d.Name], err = reveal(d.Value, disclosures, used)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		return o, nil
+	case []interface{}:
+		a := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			if m, ok := e.(map[string]interface{}); ok && len(m) == 1 {
+				if digest, ok := m["..."].(string); ok {
+					d, err := use(digest)
+					if err != nil {
+						return nil, err
+					}
+					if d == nil {
+						continue
+					}
+					if d.Name != "" {
+						return nil, ErrInvalidDisclosure
+					}
+					e, err := reveal(d.Value, disclosures, used)
+					if err != nil {
+						return nil, err
+					}
+					a = append(a, e)
+					continue
+				}
+			}
+			e, err := reveal(e, disclosures, used)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, e)
+		}
+		return a, nil
+	}
+	return v, nil
+}
+
+// 验证kb-jwt
+func (v *SDJWTVerifier) verifyKeyBinding(t *SDJWT, payload Claims, aud, nonce string) error {
+	if t.KeyBinding == "" {
+		return ErrInvalidKeyBinding
+	}
+	cnf, _ := payload["cnf"].(map[string]interface{})
+	if cnf == nil {
+		return ErrInvalidKeyBinding
+	}
+	jwk, err := jwkOfClaim(cnf["jwk"])
+	if err != nil {
+		return ErrInvalidKeyBinding
+	}
+	config := v.Config
+	if config == nil {
+		config = DefaultConfig
+	}
+	header, kb, err := VerifyWithKeyFunc(t.KeyBinding, func(header Claims) (interface{}, error) {
+		alg, _ := header["alg"].(string)
+		return jwkPublicKey(jwk, alg)
+	}, config)
+	if err != nil {
+		return err
+	}
+	if header["typ"] != KBJWTTyp {
+		return ErrInvalidKeyBinding
+	}
+	if kb["sd_hash"] != accessTokenHash(t.unbound()) {
+		return ErrInvalidKeyBinding
+	}
+	if (aud != "" && kb["aud"] != aud) || (nonce != "" && kb["nonce"] != nonce) {
+		return ErrInvalidKeyBinding
+	}
+	iat, ok := claimInt64(kb, "iat")
+	if !ok {
+		return ErrInvalidKeyBinding
+	}
+	d := config.now().Sub(time.Unix(iat, 0))
+	if d > v.KBMaxAge+config.Leeway || d < -v.KBMaxAge-config.Leeway {
+		return ErrInvalidKeyBinding
+	}
+	return nil
+}
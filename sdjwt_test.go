@@ -0,0 +1,92 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+)
+
+// 测试sd-jwt的签发，选择披露，kb-jwt和验证
+func Test_SDJWT(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	holder, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	payload := NewPayload()
+	payload.SetISS("issuer")
+	_ = payload.SetCNFJWK(&holder.PublicKey)
+	payload["given_name"] = SD("John")
+	payload["family_name"] = SD("Doe")
+	payload["address"] = SD(map[string]interface{}{
+		"country": "CN",
+		"street":  SD("street"),
+	})
+	payload["nationalities"] = []interface{}{SD("US"), "CN"}
+	issued, disclosures, err := IssueSDJWT(ES256Alg, make(Claims), Claims(payload), pro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(disclosures) != 5 {
+		t.Fatal(len(disclosures))
+	}
+	v := NewSDJWTVerifier(pro)
+	// 全部披露
+	_, claims, err := v.Verify(issued, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, _ := claims["address"].(map[string]interface{})
+	if claims["given_name"] != "John" || address["street"] != "street" || len(claims["nationalities"].([]interface{})) != 2 {
+		t.Fatal(claims)
+	}
+	if _, ok := claims["_sd_alg"]; ok {
+		t.FailNow()
+	}
+	// 只披露given_name和street，自动带上address
+	sd, err := ParseSDJWT(issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd = sd.Select(func(d *Disclosure) bool {
+		return d.Name == "given_name" || d.Name == "street"
+	})
+	if len(sd.Disclosures) != 3 {
+		t.Fatal(len(sd.Disclosures))
+	}
+	err = sd.BindKey(ES256Alg, holder, "verifier", "n-0S6_WzA2Mj", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, claims, err = v.Verify(sd.String(), "verifier", "n-0S6_WzA2Mj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, _ = claims["address"].(map[string]interface{})
+	if claims["given_name"] != "John" || claims["family_name"] != nil || address["street"] != "street" {
+		t.Fatal(claims)
+	}
+	if a := claims["nationalities"].([]interface{}); len(a) != 1 || a[0] != "CN" {
+		t.Fatal(a)
+	}
+	// nonce不对
+	_, _, err = v.Verify(sd.String(), "verifier", "other")
+	if err != ErrInvalidKeyBinding {
+		t.Fatal(err)
+	}
+	// 需要kb-jwt
+	_, _, err = v.Verify(issued, "verifier", "n-0S6_WzA2Mj")
+	if err != ErrInvalidKeyBinding {
+		t.Fatal(err)
+	}
+	// 修改披露之后sd_hash不对
+	sd.Disclosures = sd.Disclosures[1:]
+	_, _, err = v.Verify(sd.String(), "verifier", "n-0S6_WzA2Mj")
+	if err != ErrInvalidKeyBinding {
+		t.Fatal(err)
+	}
+	// 没有引用的披露
+	d, _ := newDisclosure("salt", "admin", true)
+	_, _, err = v.Verify(issued+d.Encoded+"~", "", "")
+	if err != ErrInvalidDisclosure {
+		t.Fatal(err)
+	}
+}
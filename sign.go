@@ -5,16 +5,15 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/hmac"
-	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"hash"
 	"io"
-	"math/big"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -39,22 +38,45 @@ type signer struct {
 	tokenBuffer        []byte        // token缓存
 	signBuffer         []byte        // 签名的缓存
 	bigint                           // es算法缓存
-}
-
-// 编码header和payload，写到token缓存
-func (s *signer) encode(alg Alg, header, payload Claims) (err error) {
-	// header自动填充'typ'和'alg'
-	header["jwt"] = "JWT"
-	header["alg"] = alg
+	config             *Config       // 时间和随机数来源
+	kid                string        // header没有kid时填充
+	lifetime           *KeyLifetime  // 不为nil，检查key是否可以签名
+}
+
+// 编码header和payload，写到token缓存，返回实际编码的header和payload，
+// 自动填充的字段写在拷贝上，调用者的header和payload不变
+func (s *signer) encode(alg Alg, header, payload Claims) (h, p Claims, err error) {
+	h, p = header, payload
+	if s.lifetime != nil {
+		err = s.lifetime.checkSign(s.config.now())
+		if err != nil {
+			return
+		}
+	}
+	// header自动填充'typ'和'alg'，已经有typ的不覆盖，比如at+jwt
+	h = copyClaims(header, 3)
+	if _, ok := h["typ"]; !ok {
+		h["typ"] = "JWT"
+	}
+	h["alg"] = alg
+	if _, ok := h["kid"]; !ok && s.kid != "" {
+		h["kid"] = s.kid
+	}
+	// payload自动填充'iat'和'jti'
+	p, err = setPayloadDefault(payload, s.config)
+	if err != nil {
+		p = payload
+		return
+	}
 	// json(header)
 	s.jsonHeader.Reset()
-	err = s.jsonHeaderEncoder.Encode(header)
+	err = s.jsonHeaderEncoder.Encode(h)
 	if err != nil {
 		return
 	}
 	// json(payload)
 	s.jsonPayload.Reset()
-	err = s.jsonPayloadEncoder.Encode(payload)
+	err = s.jsonPayloadEncoder.Encode(p)
 	if err != nil {
 		return
 	}
@@ -87,43 +109,27 @@ func (s *signer) base64(b []byte) {
 	base64.RawURLEncoding.Encode(s.base64Buffer, b)
 }
 
-func (s *signer) hs(w io.Writer, alg Alg, header, payload Claims, hash hash.Hash) (err error) {
-	// header.payload
-	err = s.encode(alg, header, payload)
-	if err != nil {
-		return
+// 编码header和payload，使用sign得到签名，输出token，
+// 配置了Hooks时记录结果，hook看到的是填充之后的header和payload
+func (s *signer) signTo(w io.Writer, alg Alg, header, payload Claims, sign func() ([]byte, error)) (err error) {
+	if s.config.Hooks != nil {
+		start := time.Now()
+		defer func() {
+			observeSign(s.config, alg, header, payload, start, err)
+		}()
 	}
-	// 签名
-	hash.Write(s.tokenBuffer)
-	s.signBuffer = s.signBuffer[:0]
-	s.signBuffer = hash.Sum(s.signBuffer)
-	// .sign
-	s.base64(s.signBuffer)
-	s.tokenBuffer = append(s.tokenBuffer, '.')
-	s.tokenBuffer = append(s.tokenBuffer, s.base64Buffer...)
-	// 输出
-	_, err = w.Write(s.tokenBuffer)
-	return
-}
-
-func (s *signer) rs(w io.Writer, alg Alg, header, payload Claims, hash hash.Hash, sha crypto.Hash, key *rsa.PrivateKey) (err error) {
 	// header.payload
-	err = s.encode(alg, header, payload)
+	header, payload, err = s.encode(alg, header, payload)
 	if err != nil {
 		return
 	}
-	// 哈希签名
-	hash.Write(s.tokenBuffer)
-	s.signBuffer = s.signBuffer[:0]
-	s.signBuffer = hash.Sum(s.signBuffer)
-	// rsa签名
-	var sign []byte
-	sign, err = rsa.SignPKCS1v15(rand.Reader, key, sha, s.signBuffer)
+	var b []byte
+	b, err = sign()
 	if err != nil {
 		return
 	}
 	// .sign
-	s.base64(sign)
+	s.base64(b)
 	s.tokenBuffer = append(s.tokenBuffer, '.')
 	s.tokenBuffer = append(s.tokenBuffer, s.base64Buffer...)
 	// 输出
@@ -131,58 +137,91 @@ func (s *signer) rs(w io.Writer, alg Alg, header, payload Claims, hash hash.Hash
 	return
 }
 
-func (s *signer) es(w io.Writer, alg Alg, header, payload Claims, hash hash.Hash, key *ecdsa.PrivateKey) (err error) {
-	// header.payload
-	err = s.encode(alg, header, payload)
-	if err != nil {
-		return
+func (s *signer) hs(w io.Writer, alg Alg, header, payload Claims, hash hash.Hash) error {
+	return s.signTo(w, alg, header, payload, func() ([]byte, error) {
+		s.sign(hash)
+		return s.signBuffer, nil
+	})
+}
+
+func (s *signer) rs(w io.Writer, alg Alg, header, payload Claims, hash hash.Hash, sha crypto.Hash, key *rsa.PrivateKey) error {
+	return s.signTo(w, alg, header, payload, func() ([]byte, error) {
+		s.sign(hash)
+		return rsa.SignPKCS1v15(s.config.random(), key, sha, s.signBuffer)
+	})
+}
+
+func (s *signer) es(w io.Writer, alg Alg, header, payload Claims, hash hash.Hash, sha crypto.Hash, key *ecdsa.PrivateKey) error {
+	return s.signTo(w, alg, header, payload, func() ([]byte, error) {
+		s.sign(hash)
+		rb, sb, err := s.config.signES(key, s.signBuffer, sha.New)
+		if err != nil {
+			return nil, err
+		}
+		return s.bigint.Encode(rb, sb, curveSize(&key.PublicKey)), nil
+	})
+}
+
+func (s *signer) ps(w io.Writer, alg Alg, header, payload Claims, hash hash.Hash, sha crypto.Hash, key *rsa.PrivateKey, opt *rsa.PSSOptions) error {
+	return s.signTo(w, alg, header, payload, func() ([]byte, error) {
+		s.sign(hash)
+		return rsa.SignPSS(s.config.random(), key, sha, s.signBuffer, opt)
+	})
+}
+
+// provider可以实现这个接口，签名时header没有kid会使用它
+type KeyIDProvider interface {
+	KeyID(alg Alg) string
+}
+
+func keyIDOf(provider Provider, alg Alg) string {
+	if p, ok := provider.(KeyIDProvider); ok {
+		return p.KeyID(alg)
 	}
-	// 哈希签名
-	hash.Write(s.tokenBuffer)
-	s.signBuffer = s.signBuffer[:0]
-	s.signBuffer = hash.Sum(s.signBuffer)
-	// rsa签名
-	var rb, sb *big.Int
-	rb, sb, err = ecdsa.Sign(rand.Reader, key, s.signBuffer)
-	if err != nil {
-		return
+	return ""
+}
+
+// provider实现这个接口时，私钥，pss选项和kid在同一次读取中得到，
+// 签名的同时更换key也不会用旧的key签出新的kid
+type signingKeyProvider interface {
+	signingKey(alg Alg) (key crypto.Signer, opt *rsa.PSSOptions, kid string)
+}
+
+// rs算法的私钥和kid
+func rsaKeyOf(provider Provider, alg Alg, key func() *rsa.PrivateKey) (*rsa.PrivateKey, string) {
+	if p, ok := provider.(signingKeyProvider); ok {
+		k, _, kid := p.signingKey(alg)
+		rk, _ := k.(*rsa.PrivateKey)
+		return rk, kid
 	}
-	// .sign
-	s.base64(s.bigint.Encode(rb, sb))
-	s.tokenBuffer = append(s.tokenBuffer, '.')
-	s.tokenBuffer = append(s.tokenBuffer, s.base64Buffer...)
-	// 输出
-	_, err = w.Write(s.tokenBuffer)
-	return
+	return key(), keyIDOf(provider, alg)
 }
 
-func (s *signer) ps(w io.Writer, alg Alg, header, payload Claims, hash hash.Hash, sha crypto.Hash, key *rsa.PrivateKey, opt *rsa.PSSOptions) (err error) {
-	// header.payload
-	err = s.encode(alg, header, payload)
-	if err != nil {
-		return
+// ps算法的私钥，pss选项和kid
+func psKeyOf(provider Provider, alg Alg, key func() *rsa.PrivateKey, opt func() *rsa.PSSOptions) (*rsa.PrivateKey, *rsa.PSSOptions, string) {
+	if p, ok := provider.(signingKeyProvider); ok {
+		k, o, kid := p.signingKey(alg)
+		rk, _ := k.(*rsa.PrivateKey)
+		return rk, o, kid
 	}
-	// 哈希签名
-	hash.Write(s.tokenBuffer)
-	s.signBuffer = s.signBuffer[:0]
-	s.signBuffer = hash.Sum(s.signBuffer)
-	// rsa签名
-	var sign []byte
-	sign, err = rsa.SignPSS(rand.Reader, key, sha, s.signBuffer, opt)
-	if err != nil {
-		return err
+	return key(), opt(), keyIDOf(provider, alg)
+}
+
+// es算法的私钥和kid
+func ecdsaKeyOf(provider Provider, alg Alg, key func() *ecdsa.PrivateKey) (*ecdsa.PrivateKey, string) {
+	if p, ok := provider.(signingKeyProvider); ok {
+		k, _, kid := p.signingKey(alg)
+		ek, _ := k.(*ecdsa.PrivateKey)
+		return ek, kid
 	}
-	// .sign
-	s.base64(sign)
-	s.tokenBuffer = append(s.tokenBuffer, '.')
-	s.tokenBuffer = append(s.tokenBuffer, s.base64Buffer...)
-	// 输出
-	_, err = w.Write(s.tokenBuffer)
-	return
+	return key(), keyIDOf(provider, alg)
 }
 
 func SignHS256To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	s.kid = keyIDOf(provider, HS256Alg)
+	s.lifetime = keyLifetimeOf(provider, HS256Alg)
 	h := provider.GetHS256()
 	err := s.hs(w, "HS256", header, payload, h)
 	provider.PutHS256(h)
@@ -192,6 +231,9 @@ func SignHS256To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignHS384To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	s.kid = keyIDOf(provider, HS384Alg)
+	s.lifetime = keyLifetimeOf(provider, HS384Alg)
 	h := provider.GetHS384()
 	err := s.hs(w, "HS384", header, payload, h)
 	provider.PutHS384(h)
@@ -201,6 +243,9 @@ func SignHS384To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignHS512To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	s.kid = keyIDOf(provider, HS512Alg)
+	s.lifetime = keyLifetimeOf(provider, HS512Alg)
 	h := provider.GetHS512()
 	err := s.hs(w, "HS512", header, payload, h)
 	provider.PutHS512(h)
@@ -210,8 +255,12 @@ func SignHS512To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignRS256To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	key, kid := rsaKeyOf(provider, RS256Alg, provider.RS256Key)
+	s.kid = kid
+	s.lifetime = keyLifetimeOf(provider, RS256Alg)
 	h := provider.GetSha256()
-	err := s.rs(w, "RS256", header, payload, h, crypto.SHA256, provider.RS256Key())
+	err := s.rs(w, "RS256", header, payload, h, crypto.SHA256, key)
 	provider.PutSha256(h)
 	signerPool.Put(s)
 	return err
@@ -219,8 +268,12 @@ func SignRS256To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignRS384To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	key, kid := rsaKeyOf(provider, RS384Alg, provider.RS384Key)
+	s.kid = kid
+	s.lifetime = keyLifetimeOf(provider, RS384Alg)
 	h := provider.GetSha384()
-	err := s.rs(w, "RS384", header, payload, h, crypto.SHA384, provider.RS384Key())
+	err := s.rs(w, "RS384", header, payload, h, crypto.SHA384, key)
 	provider.PutSha384(h)
 	signerPool.Put(s)
 	return err
@@ -228,8 +281,12 @@ func SignRS384To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignRS512To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	key, kid := rsaKeyOf(provider, RS512Alg, provider.RS512Key)
+	s.kid = kid
+	s.lifetime = keyLifetimeOf(provider, RS512Alg)
 	h := provider.GetSha512()
-	err := s.rs(w, "RS512", header, payload, h, crypto.SHA512, provider.RS512Key())
+	err := s.rs(w, "RS512", header, payload, h, crypto.SHA512, key)
 	provider.PutSha512(h)
 	signerPool.Put(s)
 	return err
@@ -237,8 +294,12 @@ func SignRS512To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignES256To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	key, kid := ecdsaKeyOf(provider, ES256Alg, provider.ES256Key)
+	s.kid = kid
+	s.lifetime = keyLifetimeOf(provider, ES256Alg)
 	h := provider.GetSha256()
-	err := s.es(w, "ES256", header, payload, h, provider.ES256Key())
+	err := s.es(w, "ES256", header, payload, h, crypto.SHA256, key)
 	provider.PutSha256(h)
 	signerPool.Put(s)
 	return err
@@ -246,8 +307,12 @@ func SignES256To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignES384To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	key, kid := ecdsaKeyOf(provider, ES384Alg, provider.ES384Key)
+	s.kid = kid
+	s.lifetime = keyLifetimeOf(provider, ES384Alg)
 	h := provider.GetSha384()
-	err := s.es(w, "ES384", header, payload, h, provider.ES384Key())
+	err := s.es(w, "ES384", header, payload, h, crypto.SHA384, key)
 	signerPool.Put(s)
 	provider.PutSha384(h)
 	return err
@@ -255,8 +320,12 @@ func SignES384To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignES512To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	key, kid := ecdsaKeyOf(provider, ES512Alg, provider.ES512Key)
+	s.kid = kid
+	s.lifetime = keyLifetimeOf(provider, ES512Alg)
 	h := provider.GetSha512()
-	err := s.es(w, "ES512", header, payload, h, provider.ES512Key())
+	err := s.es(w, "ES512", header, payload, h, crypto.SHA512, key)
 	provider.PutSha512(h)
 	signerPool.Put(s)
 	return err
@@ -264,8 +333,12 @@ func SignES512To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignPS256To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	key, opt, kid := psKeyOf(provider, PS256Alg, provider.PS256Key, provider.PS256Opt)
+	s.kid = kid
+	s.lifetime = keyLifetimeOf(provider, PS256Alg)
 	h := provider.GetSha256()
-	err := s.ps(w, "PS256", header, payload, h, crypto.SHA256, provider.PS256Key(), provider.PS256Opt())
+	err := s.ps(w, "PS256", header, payload, h, crypto.SHA256, key, opt)
 	provider.PutSha256(h)
 	signerPool.Put(s)
 	return err
@@ -273,8 +346,12 @@ func SignPS256To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignPS384To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	key, opt, kid := psKeyOf(provider, PS384Alg, provider.PS384Key, provider.PS384Opt)
+	s.kid = kid
+	s.lifetime = keyLifetimeOf(provider, PS384Alg)
 	h := provider.GetSha384()
-	err := s.ps(w, "PS384", header, payload, h, crypto.SHA384, provider.PS384Key(), provider.PS384Opt())
+	err := s.ps(w, "PS384", header, payload, h, crypto.SHA384, key, opt)
 	provider.PutSha384(h)
 	signerPool.Put(s)
 	return err
@@ -282,8 +359,12 @@ func SignPS384To(w io.Writer, header, payload Claims, provider Provider) error {
 
 func SignPS512To(w io.Writer, header, payload Claims, provider Provider) error {
 	s := signerPool.Get().(*signer)
+	s.config = configOf(provider)
+	key, opt, kid := psKeyOf(provider, PS512Alg, provider.PS512Key, provider.PS512Opt)
+	s.kid = kid
+	s.lifetime = keyLifetimeOf(provider, PS512Alg)
 	h := provider.GetSha512()
-	err := s.ps(w, "PS512", header, payload, h, crypto.SHA512, provider.PS512Key(), provider.PS512Opt())
+	err := s.ps(w, "PS512", header, payload, h, crypto.SHA512, key, opt)
 	provider.PutSha512(h)
 	signerPool.Put(s)
 	return err
@@ -322,6 +403,9 @@ func SignTo(w io.Writer, alg Alg, header, payload Claims, provider Provider) err
 
 func SignHS256WithSecretTo(w io.Writer, header, payload Claims, secret string) error {
 	s := signerPool.Get().(*signer)
+	s.config = DefaultConfig
+	s.kid = ""
+	s.lifetime = nil
 	s.tokenBuffer = s.tokenBuffer[:0]
 	s.tokenBuffer = append(s.tokenBuffer, secret...)
 	err := s.hs(w, "HS256", header, payload, hmac.New(crypto.SHA256.New, s.tokenBuffer))
@@ -331,6 +415,9 @@ func SignHS256WithSecretTo(w io.Writer, header, payload Claims, secret string) e
 
 func SignHS384WithSecretTo(w io.Writer, header, payload Claims, secret string) error {
 	s := signerPool.Get().(*signer)
+	s.config = DefaultConfig
+	s.kid = ""
+	s.lifetime = nil
 	s.tokenBuffer = s.tokenBuffer[:0]
 	s.tokenBuffer = append(s.tokenBuffer, secret...)
 	err := s.hs(w, "HS384", header, payload, hmac.New(crypto.SHA384.New, s.tokenBuffer))
@@ -340,6 +427,9 @@ func SignHS384WithSecretTo(w io.Writer, header, payload Claims, secret string) e
 
 func SignHS512WithSecretTo(w io.Writer, header, payload Claims, secret string) error {
 	s := signerPool.Get().(*signer)
+	s.config = DefaultConfig
+	s.kid = ""
+	s.lifetime = nil
 	s.tokenBuffer = s.tokenBuffer[:0]
 	s.tokenBuffer = append(s.tokenBuffer, secret...)
 	err := s.hs(w, "HS512", header, payload, hmac.New(crypto.SHA512.New, s.tokenBuffer))
@@ -349,80 +439,153 @@ func SignHS512WithSecretTo(w io.Writer, header, payload Claims, secret string) e
 
 func SignHS256(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignHS256To(&str, header, payload, provider)
+	err := SignHS256To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignHS384(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignHS384To(&str, header, payload, provider)
+	err := SignHS384To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignHS512(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignHS512To(&str, header, payload, provider)
+	err := SignHS512To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignRS256(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignRS256To(&str, header, payload, provider)
+	err := SignRS256To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignRS384(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignRS384To(&str, header, payload, provider)
+	err := SignRS384To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignRS512(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignRS512To(&str, header, payload, provider)
+	err := SignRS512To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignES256(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignES256To(&str, header, payload, provider)
+	err := SignES256To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignES384(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignES384To(&str, header, payload, provider)
+	err := SignES384To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignES512(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignES512To(&str, header, payload, provider)
+	err := SignES512To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignPS256(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignPS256To(&str, header, payload, provider)
+	err := SignPS256To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignPS384(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignPS384To(&str, header, payload, provider)
+	err := SignPS384To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func SignPS512(header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignPS512To(&str, header, payload, provider)
+	err := SignPS512To(&str, header, payload, provider)
+	return str.String(), err
 }
 
 func Sign(alg Alg, header, payload Claims, provider Provider) (string, error) {
 	var str strings.Builder
-	return str.String(), SignTo(&str, alg, header, payload, provider)
+	err := SignTo(&str, alg, header, payload, provider)
+	return str.String(), err
 }
 
 func SignHS256WithSecret(header, payload Claims, secret string) (string, error) {
 	var str strings.Builder
-	return str.String(), SignHS256WithSecretTo(&str, header, payload, secret)
+	err := SignHS256WithSecretTo(&str, header, payload, secret)
+	return str.String(), err
 }
 
 func SignHS384WithSecret(header, payload Claims, secret string) (string, error) {
 	var str strings.Builder
-	return str.String(), SignHS384WithSecretTo(&str, header, payload, secret)
+	err := SignHS384WithSecretTo(&str, header, payload, secret)
+	return str.String(), err
 }
 
 func SignHS512WithSecret(header, payload Claims, secret string) (string, error) {
 	var str strings.Builder
-	return str.String(), SignHS512WithSecretTo(&str, header, payload, secret)
+	err := SignHS512WithSecretTo(&str, header, payload, secret)
+	return str.String(), err
+}
+
+// 使用key签名，适用于不是Provider管理的key，config是nil使用DefaultConfig，
+// hs算法是[]byte，rs和ps算法是*rsa.PrivateKey，es算法是*ecdsa.PrivateKey
+func SignWithKeyTo(w io.Writer, alg Alg, header, payload Claims, key interface{}, config *Config) error {
+	if config == nil {
+		config = DefaultConfig
+	}
+	h := alg.Hash()
+	if h == 0 {
+		return observeSign(config, alg, header, payload, time.Now(), fmt.Errorf("unsupported algorithm <%s>", alg))
+	}
+	var err error
+	s := signerPool.Get().(*signer)
+	s.config = config
+	s.kid = ""
+	s.lifetime = nil
+	switch strings.ToUpper(string(alg[:2])) {
+	case "HS":
+		k, ok := key.([]byte)
+		if !ok {
+			err = observeSign(config, alg, header, payload, time.Now(), ErrUnsupportedKey)
+			break
+		}
+		err = s.hs(w, alg, header, payload, hmac.New(h.New, k))
+	case "RS":
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			err = observeSign(config, alg, header, payload, time.Now(), ErrUnsupportedKey)
+			break
+		}
+		err = s.rs(w, alg, header, payload, h.New(), h, k)
+	case "ES":
+		k, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			err = observeSign(config, alg, header, payload, time.Now(), ErrUnsupportedKey)
+			break
+		}
+		err = s.es(w, alg, header, payload, h.New(), h, k)
+	case "PS":
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			err = observeSign(config, alg, header, payload, time.Now(), ErrUnsupportedKey)
+			break
+		}
+		err = s.ps(w, alg, header, payload, h.New(), h, k, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	default:
+		err = fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+	signerPool.Put(s)
+	return err
+}
+
+func SignWithKey(alg Alg, header, payload Claims, key interface{}, config *Config) (string, error) {
+	var str strings.Builder
+	err := SignWithKeyTo(&str, alg, header, payload, key, config)
+	return str.String(), err
 }
@@ -0,0 +1,269 @@
+package jwt
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidTenant   = errors.New("invalid tenant")
+	ErrInvalidMasterID = errors.New("invalid master id")
+)
+
+// 默认的租户字段
+const DefaultTenantClaim = "tid"
+
+func NewTenantKeys(masterID string, master []byte, cacheSize int) (*TenantKeys, error) {
+	t := new(TenantKeys)
+	t.TenantClaim = DefaultTenantClaim
+	t.masters = make(map[string][]byte)
+	t.cache = newKeyCache(cacheSize)
+	err := t.Rotate(masterID, master)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// 使用hkdf从主密钥派生每个租户的hs key，
+// kid是"主密钥id:租户"，派生的key缓存在lru中
+type TenantKeys struct {
+	TenantClaim string  // payload中租户的字段
+	Config      *Config // nil使用DefaultConfig
+	lock        sync.RWMutex
+	current     string            // 签名使用的主密钥id
+	masters     map[string][]byte // 所有的主密钥，旧的用于验证
+	gen         uint64            // masters每次修改加1，派生期间修改了就不缓存
+	cache       *keyCache
+}
+
+// kid使用':'分隔主密钥id和租户，id不能为空，不能包含':'
+func checkMasterID(id string) error {
+	if id == "" || strings.IndexByte(id, ':') >= 0 {
+		return ErrInvalidMasterID
+	}
+	return nil
+}
+
+// 修改masters，在锁内清除缓存，
+// 之前派生的key要么在清除之前放入，要么因为gen改变不放入
+func (t *TenantKeys) update(f func()) {
+	t.lock.Lock()
+	f()
+	t.gen++
+	t.cache.clear()
+	t.lock.Unlock()
+}
+
+// 添加主密钥，只用于验证，id不能包含':'
+func (t *TenantKeys) AddMaster(id string, master []byte) error {
+	err := checkMasterID(id)
+	if err != nil {
+		return err
+	}
+	t.update(func() {
+		t.masters[id] = master
+	})
+	return nil
+}
+
+// 添加主密钥，然后用它签名，旧的主密钥还可以验证，直到RemoveMaster，
+// id不能包含':'
+func (t *TenantKeys) Rotate(id string, master []byte) error {
+	err := checkMasterID(id)
+	if err != nil {
+		return err
+	}
+	t.update(func() {
+		t.masters[id] = master
+		t.current = id
+	})
+	return nil
+}
+
+// 删除主密钥，不能删除当前的
+func (t *TenantKeys) RemoveMaster(id string) {
+	t.update(func() {
+		if id != t.current {
+			delete(t.masters, id)
+		}
+	})
+}
+
+// 返回派生的key
+func (t *TenantKeys) Key(masterID, tenant string, alg Alg) ([]byte, error) {
+	h := alg.Hash()
+	if h == 0 || !strings.HasPrefix(string(alg), "HS") {
+		return nil, fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+	if tenant == "" {
+		return nil, ErrInvalidTenant
+	}
+	t.lock.RLock()
+	master, ok := t.masters[masterID]
+	gen := t.gen
+	t.lock.RUnlock()
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	name := masterID + "\x00" + string(alg) + "\x00" + tenant
+	if k := t.cache.get(name); k != nil {
+		return k, nil
+	}
+	k := hkdf(h.New, master, nil, []byte("jwt "+string(alg)+" "+tenant), h.Size())
+	// 派生期间主密钥改变了，k可能来自旧的主密钥，不缓存
+	t.lock.RLock()
+	if t.gen == gen {
+		t.cache.put(name, k)
+	}
+	t.lock.RUnlock()
+	return k, nil
+}
+
+// 使用当前主密钥派生的key签名，设置header.kid和payload的租户字段
+func (t *TenantKeys) Sign(alg Alg, tenant string, header, payload Claims) (string, error) {
+	t.lock.RLock()
+	id := t.current
+	t.lock.RUnlock()
+	k, err := t.Key(id, tenant, alg)
+	if err != nil {
+		return "", err
+	}
+	header = copyClaims(header, 1)
+	header["kid"] = id + ":" + tenant
+	payload = copyClaims(payload, 1)
+	payload[t.TenantClaim] = tenant
+	return SignWithKey(alg, header, payload, k, t.Config)
+}
+
+// 实现KeyFunc，从header.kid中得到主密钥和租户
+func (t *TenantKeys) KeyFunc(header Claims) (interface{}, error) {
+	kid, _ := header["kid"].(string)
+	alg, _ := header["alg"].(string)
+	i := strings.IndexByte(kid, ':')
+	if i < 0 {
+		return nil, ErrKeyNotFound
+	}
+	return t.Key(kid[:i], kid[i+1:], Alg(alg))
+}
+
+// 验证token，没有kid使用租户字段和当前主密钥，
+// 两个都有的时候必须是同一个租户
+func (t *TenantKeys) Verify(token string) (header, payload Claims, err error) {
+	header, payload, _, err = parseUnverified(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	tenant, _ := payload[t.TenantClaim].(string)
+	kid, _ := header["kid"].(string)
+	masterID := ""
+	if i := strings.IndexByte(kid, ':'); i >= 0 {
+		masterID = kid[:i]
+		if tenant != "" && tenant != kid[i+1:] {
+			return nil, nil, ErrInvalidTenant
+		}
+		tenant = kid[i+1:]
+	} else {
+		t.lock.RLock()
+		masterID = t.current
+		t.lock.RUnlock()
+	}
+	return VerifyWithKeyFunc(token, func(header Claims) (interface{}, error) {
+		alg, _ := header["alg"].(string)
+		return t.Key(masterID, tenant, Alg(alg))
+	}, t.Config)
+}
+
+// rfc5869 hkdf
+func hkdf(newHash func() hash.Hash, secret, salt, info []byte, size int) []byte {
+	if salt == nil {
+		salt = make([]byte, newHash().Size())
+	}
+	// extract
+	m := hmac.New(newHash, salt)
+	m.Write(secret)
+	prk := m.Sum(nil)
+	// expand
+	m = hmac.New(newHash, prk)
+	key := make([]byte, 0, size+m.Size())
+	var t []byte
+	for i := byte(1); len(key) < size; i++ {
+		m.Reset()
+		m.Write(t)
+		m.Write(info)
+		m.Write([]byte{i})
+		t = m.Sum(t[:0])
+		key = append(key, t...)
+	}
+	return key[:size]
+}
+
+// 有上限的lru缓存
+type keyCache struct {
+	lock  sync.Mutex
+	size  int
+	list  *list.List
+	items map[string]*list.Element
+}
+
+type keyCacheItem struct {
+	name string
+	key  []byte
+}
+
+// size小于1表示不缓存
+func newKeyCache(size int) *keyCache {
+	c := new(keyCache)
+	c.size = size
+	c.list = list.New()
+	c.items = make(map[string]*list.Element)
+	return c
+}
+
+func (c *keyCache) get(name string) []byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.items[name]
+	if !ok {
+		return nil
+	}
+	c.list.MoveToFront(e)
+	return e.Value.(*keyCacheItem).key
+}
+
+func (c *keyCache) put(name string, key []byte) {
+	if c.size < 1 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if e, ok := c.items[name]; ok {
+		e.Value.(*keyCacheItem).key = key
+		c.list.MoveToFront(e)
+		return
+	}
+	c.items[name] = c.list.PushFront(&keyCacheItem{name: name, key: key})
+	for c.list.Len() > c.size {
+		e := c.list.Back()
+		c.list.Remove(e)
+		delete(c.items, e.Value.(*keyCacheItem).name)
+	}
+}
+
+func (c *keyCache) len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.list.Len()
+}
+
+func (c *keyCache) clear() {
+	c.lock.Lock()
+	c.list.Init()
+	c.items = make(map[string]*list.Element)
+	c.lock.Unlock()
+}
@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/hmac"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"hash"
+	"math/big"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -136,6 +139,9 @@ func (v *verifier) es(h hash.Hash, k *ecdsa.PrivateKey) error {
 	if err != nil {
 		return err
 	}
+	if len(v.base64Buffer) != 2*curveSize(&k.PublicKey) {
+		return ErrInvalidToken
+	}
 	v.bigint.Decode(v.base64Buffer)
 	// 验证
 	if !ecdsa.Verify(&k.PublicKey, v.hashBuffer, &v.bigint.r, &v.bigint.s) {
@@ -156,8 +162,11 @@ func (v *verifier) rs(h hash.Hash, c crypto.Hash, k *rsa.PrivateKey) error {
 	if err != nil {
 		return err
 	}
-	// 验证
-	return rsa.VerifyPKCS1v15(&k.PublicKey, c, v.hashBuffer, v.base64Buffer)
+	// 验证，和其他算法一样，签名错误返回ErrInvalidToken
+	if rsa.VerifyPKCS1v15(&k.PublicKey, c, v.hashBuffer, v.base64Buffer) != nil {
+		return ErrInvalidToken
+	}
+	return nil
 }
 
 // 验证ps算法
@@ -173,11 +182,20 @@ func (v *verifier) ps(h hash.Hash, c crypto.Hash, k *rsa.PrivateKey, o *rsa.PSSO
 		return err
 	}
 	// verify
-	return rsa.VerifyPSS(&k.PublicKey, c, v.hashBuffer, v.base64Buffer, o)
+	if rsa.VerifyPSS(&k.PublicKey, c, v.hashBuffer, v.base64Buffer, o) != nil {
+		return ErrInvalidToken
+	}
+	return nil
 }
 
 // 使用默认的provider进行验证
 func Verify(token string, provider Provider) (header, payload Claims, err error) {
+	if c := configOf(provider); c.Hooks != nil {
+		start := time.Now()
+		defer func() {
+			observeVerify(c, token, header, payload, start, err)
+		}()
+	}
 	v := verifierPool.Get().(*verifier)
 	// 切分token
 	err = v.parseToken(token)
@@ -204,6 +222,15 @@ func Verify(token string, provider Provider) (header, payload Claims, err error)
 	if !ok {
 		return nil, nil, ErrInvalidToken
 	}
+	// 退役的key
+	payload, ok, err = verifyRetired(token, Alg(strings.ToUpper(alg)), header, provider)
+	if ok {
+		verifierPool.Put(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		return header, payload, nil
+	}
 	// 根据算法解析
 	switch strings.ToUpper(alg) {
 	case "HS256":
@@ -275,5 +302,209 @@ func Verify(token string, provider Provider) (header, payload Claims, err error)
 		return nil, nil, err
 	}
 	verifierPool.Put(v)
+	// exp，nbf和jti
+	config := configOf(provider)
+	err = config.validate(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	// key的有效期
+	if l := keyLifetimeOf(provider, Alg(strings.ToUpper(alg))); l != nil {
+		err = l.validate(payload, config)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return
+}
+
+// 根据header返回验证签名的key，
+// hs算法是[]byte，rs和ps算法是*rsa.PublicKey，es算法是*ecdsa.PublicKey，也可以是对应的私钥，
+// 返回*LifetimeKey时还会检查key的有效期
+type KeyFunc func(header Claims) (interface{}, error)
+
+// 使用keyFunc返回的key进行验证，适用于jwks这类不是Provider管理的key，
+// config是nil使用DefaultConfig
+func VerifyWithKeyFunc(token string, keyFunc KeyFunc, config *Config) (header, payload Claims, err error) {
+	if config == nil {
+		config = DefaultConfig
+	}
+	if config.Hooks != nil {
+		start := time.Now()
+		defer func() {
+			observeVerify(config, token, header, payload, start, err)
+		}()
+	}
+	var sign []byte
+	header, payload, sign, err = parseUnverified(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	alg, ok := header["alg"].(string)
+	if !ok {
+		return nil, nil, ErrInvalidToken
+	}
+	key, err := keyFunc(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	var lifetime *KeyLifetime
+	if k, ok := key.(*LifetimeKey); ok {
+		key, lifetime = k.Key, k.Lifetime
+	}
+	err = verifyWithKey(Alg(alg), token, payload, sign, key, lifetime, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+// 验证签名，payload和key的有效期，lifetime可以是nil
+func verifyWithKey(alg Alg, token string, payload Claims, sign []byte, key interface{}, lifetime *KeyLifetime, config *Config) error {
+	err := verifySignature(alg, token[:strings.LastIndexByte(token, '.')], sign, key)
+	if err != nil {
+		return err
+	}
+	err = config.validate(payload)
+	if err != nil {
+		return err
+	}
+	if lifetime != nil {
+		return lifetime.validate(payload, config)
+	}
+	return nil
+}
+
+// provider可以实现这个接口，header.kid不是当前的key时，
+// 使用kid找到已经退役但是还在grace期间的key
+type retiredKeyProvider interface {
+	retiredKey(alg Alg, kid string) (key interface{}, lifetime *KeyLifetime)
+}
+
+// 使用provider中kid对应的退役key验证，没有这个key返回false
+func verifyRetired(token string, alg Alg, header Claims, provider Provider) (payload Claims, ok bool, err error) {
+	p, ok := provider.(retiredKeyProvider)
+	if !ok {
+		return nil, false, nil
+	}
+	kid, _ := header["kid"].(string)
+	if kid == "" || kid == keyIDOf(provider, alg) {
+		return nil, false, nil
+	}
+	key, lifetime := p.retiredKey(alg, kid)
+	if key == nil {
+		return nil, false, nil
+	}
+	_, payload, sign, err := parseUnverified(token)
+	if err == nil {
+		err = verifyWithKey(alg, token, payload, sign, key, lifetime, configOf(provider))
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return payload, true, nil
+}
+
+// 解析token，不验证签名
+func parseUnverified(token string) (header, payload Claims, sign []byte, err error) {
+	part := strings.Split(token, ".")
+	if len(part) != 3 {
+		return nil, nil, nil, ErrInvalidToken
+	}
+	header, err = decodeClaims(part[0])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	payload, err = decodeClaims(part[1])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sign, err = base64.RawURLEncoding.DecodeString(part[2])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidToken
+	}
 	return
 }
+
+// json(base64(claims))
+func decodeClaims(s string) (Claims, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	c := make(Claims)
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return c, nil
+}
+
+// 使用key验证签名
+func verifySignature(alg Alg, input string, sign []byte, key interface{}) error {
+	h := alg.Hash()
+	if h == 0 {
+		return fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+	switch strings.ToUpper(string(alg[:2])) {
+	case "HS":
+		k, ok := key.([]byte)
+		if !ok {
+			return ErrUnsupportedKey
+		}
+		m := hmac.New(h.New, k)
+		m.Write([]byte(input))
+		if !hmac.Equal(m.Sum(nil), sign) {
+			return ErrInvalidToken
+		}
+		return nil
+	case "RS", "PS":
+		var k *rsa.PublicKey
+		switch v := key.(type) {
+		case *rsa.PublicKey:
+			k = v
+		case *rsa.PrivateKey:
+			k = &v.PublicKey
+		default:
+			return ErrUnsupportedKey
+		}
+		d := h.New()
+		d.Write([]byte(input))
+		if alg[0] == 'R' || alg[0] == 'r' {
+			err := rsa.VerifyPKCS1v15(k, h, d.Sum(nil), sign)
+			if err != nil {
+				return ErrInvalidToken
+			}
+			return nil
+		}
+		err := rsa.VerifyPSS(k, h, d.Sum(nil), sign, nil)
+		if err != nil {
+			return ErrInvalidToken
+		}
+		return nil
+	case "ES":
+		var k *ecdsa.PublicKey
+		switch v := key.(type) {
+		case *ecdsa.PublicKey:
+			k = v
+		case *ecdsa.PrivateKey:
+			k = &v.PublicKey
+		default:
+			return ErrUnsupportedKey
+		}
+		size := curveSize(k)
+		if len(sign) != 2*size {
+			return ErrInvalidToken
+		}
+		d := h.New()
+		d.Write([]byte(input))
+		r := new(big.Int).SetBytes(sign[:size])
+		s := new(big.Int).SetBytes(sign[size:])
+		if !ecdsa.Verify(k, d.Sum(nil), r, s) {
+			return ErrInvalidToken
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm <%s>", alg)
+	}
+}
@@ -0,0 +1,337 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 测试用的证书，parent是nil表示自签名
+func newTestCert(t *testing.T, cn string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	return newTestCertWith(t, cn, ca, parent, parentKey, nil)
+}
+
+// set修改证书模板
+func newTestCertWith(t *testing.T, cn string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, set func(*x509.Certificate)) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if ca {
+		tpl.IsCA = true
+		tpl.BasicConstraintsValid = true
+		tpl.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	if set != nil {
+		set(tpl)
+	}
+	if parent == nil {
+		parent, parentKey = tpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// 测试cnf的jkt和mtls绑定
+func Test_Confirmation(t *testing.T) {
+	pro := NewDefaultProvider("hs256", "hs384", "hs512")
+	holder, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	payload := NewPayload()
+	_ = payload.SetCNFJWK(&holder.PublicKey)
+	_ = payload.SetCNFJKT(&holder.PublicKey)
+	token, _ := Sign(ES256Alg, make(Claims), Claims(payload), pro)
+	_, _, err := VerifyConfirmation(token, pro, &holder.PublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = VerifyConfirmation(token, pro, &other.PublicKey, nil)
+	if err != ErrConfirmation {
+		t.Fatal(err)
+	}
+	// mtls
+	cert, key := newTestCert(t, "client", false, nil, nil)
+	payload = NewPayload()
+	payload.SetCNFX5T(cert)
+	token, _ = Sign(ES256Alg, make(Claims), Claims(payload), pro)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, err := VerifyConfirmation(r.Header.Get("Authorization"), pro, nil, r)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	do := func(cert *x509.Certificate, key *ecdsa.PrivateKey) int {
+		client := server.Client()
+		client.CloseIdleConnections()
+		client.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{
+			{Certificate: [][]byte{cert.Raw}, PrivateKey: key},
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		req.Header.Set("Authorization", token)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if status := do(cert, key); status != http.StatusOK {
+		t.Fatal(status)
+	}
+	cert, key = newTestCert(t, "client", false, nil, nil)
+	if status := do(cert, key); status != http.StatusUnauthorized {
+		t.Fatal(status)
+	}
+}
+
+// 测试x5c证书链验证
+func Test_X5C(t *testing.T) {
+	root, rootKey := newTestCert(t, "root", true, nil, nil)
+	inter, interKey := newTestCert(t, "inter", true, root, rootKey)
+	leaf, leafKey := newTestCert(t, "leaf", false, inter, interKey)
+	header := NewHeader()
+	header.SetX5C(leaf, inter)
+	token, err := SignWithKey(ES256Alg, Claims(header), make(Claims), leafKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	now := time.Now()
+	v, err := NewX5CVerifier(roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Config = &Config{Clock: ClockFunc(func() time.Time { return now })}
+	_, _, err = v.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不信任的根
+	other, _ := newTestCert(t, "other", true, nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(other)
+	v2, _ := NewX5CVerifier(pool)
+	_, _, err = v2.Verify(token)
+	if err == nil {
+		t.FailNow()
+	}
+	// 没有根证书不能使用系统的根证书
+	_, err = NewX5CVerifier(nil)
+	if err != ErrNoTrustedRoots {
+		t.Fatal(err)
+	}
+	_, err = NewX5CVerifier(x509.NewCertPool())
+	if err != ErrNoTrustedRoots {
+		t.Fatal(err)
+	}
+	_, _, err = (&X5CVerifier{}).Verify(token)
+	if err != ErrNoTrustedRoots {
+		t.Fatal(err)
+	}
+	// 证书过期
+	now = now.Add(2 * time.Hour)
+	_, _, err = v.Verify(token)
+	if err == nil {
+		t.FailNow()
+	}
+	// 别的key签名
+	now = time.Now()
+	_, otherKey := newTestCert(t, "leaf", false, inter, interKey)
+	token, _ = SignWithKey(ES256Alg, Claims(header), make(Claims), otherKey, nil)
+	_, _, err = v.Verify(token)
+	if err != ErrInvalidToken {
+		t.Fatal(err)
+	}
+}
+
+// 颁发者签名的ocsp响应
+func newTestOCSPResponse(t *testing.T, cert, issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey, status int, now time.Time) []byte {
+	id, err := newOCSPCertID(cert, issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	single := ocspSingleResponse{
+		CertID:     *id,
+		ThisUpdate: now.Add(-time.Minute).UTC(),
+		NextUpdate: now.Add(time.Hour).UTC(),
+	}
+	switch status {
+	case ocspGood:
+		single.Good = true
+	case ocspRevoked:
+		single.Revoked = ocspRevokedInfo{RevocationTime: now.Add(-time.Minute).UTC()}
+	default:
+		single.Unknown = true
+	}
+	tbs, err := asn1.Marshal(ocspResponseData{
+		RawResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: issuer.RawSubject},
+		ProducedAt:     now.UTC(),
+		Responses:      []ocspSingleResponse{single},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	sig, err := ecdsa.SignASN1(rand.Reader, issuerKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	basic, err := asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: sig, BitLength: len(sig) * 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := asn1.Marshal(ocspResponse{
+		Response: ocspResponseBytes{ResponseType: oidOCSPBasicResponse, Response: basic},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// 测试x5c证书的ocsp和crl吊销检查
+func Test_CertRevocation(t *testing.T) {
+	root, rootKey := newTestCert(t, "root", true, nil, nil)
+	now := time.Now()
+	// ocsp服务
+	status, hits := ocspGood, 0
+	var leaf *x509.Certificate
+	ocsp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if status < 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(newTestOCSPResponse(t, leaf, root, rootKey, status, now))
+	}))
+	defer ocsp.Close()
+	leaf, leafKey := newTestCertWith(t, "leaf", false, root, rootKey, func(c *x509.Certificate) {
+		c.OCSPServer = []string{ocsp.URL}
+	})
+	header := NewHeader()
+	header.SetX5C(leaf)
+	token, _ := SignWithKey(ES256Alg, Claims(header), make(Claims), leafKey, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	verify := func(checker *CertRevocationChecker) error {
+		v, _ := NewX5CVerifier(roots)
+		v.Config = &Config{Clock: ClockFunc(func() time.Time { return now })}
+		v.Revocation = checker
+		_, _, err := v.Verify(token)
+		return err
+	}
+	// ocsp good，第二次使用缓存
+	checker := NewCertRevocationChecker(HardFail)
+	if err := verify(checker); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(checker); err != nil || hits != 1 {
+		t.Fatal(err, hits)
+	}
+	// ocsp revoked
+	status = ocspRevoked
+	if err := verify(NewCertRevocationChecker(SoftFail)); err != ErrCertificateRevoked {
+		t.Fatal(err)
+	}
+	// ocsp服务失败
+	status = -1
+	if err := verify(NewCertRevocationChecker(SoftFail)); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(NewCertRevocationChecker(HardFail)); err != ErrCertificateStatusUnknown {
+		t.Fatal(err)
+	}
+	// 本地crl
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: now.Add(-time.Minute),
+		NextUpdate: now.Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: leaf.SerialNumber, RevocationTime: now.Add(-time.Minute)},
+		},
+	}, root, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "root.crl")
+	err = ioutil.WriteFile(path, crl, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker = NewCertRevocationChecker(HardFail)
+	err = checker.LoadCRLFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(checker); err != ErrCertificateRevoked {
+		t.Fatal(err)
+	}
+	// crl分发点，没有吊销
+	crl, _ = x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(2),
+		ThisUpdate: now.Add(-time.Minute),
+		NextUpdate: now.Add(time.Hour),
+	}, root, rootKey)
+	crlServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(crl)
+	}))
+	defer crlServer.Close()
+	leaf, leafKey = newTestCertWith(t, "leaf", false, root, rootKey, func(c *x509.Certificate) {
+		c.CRLDistributionPoints = []string{crlServer.URL}
+	})
+	header.SetX5C(leaf)
+	token, _ = SignWithKey(ES256Alg, Claims(header), make(Claims), leafKey, nil)
+	if err := verify(NewCertRevocationChecker(HardFail)); err != nil {
+		t.Fatal(err)
+	}
+	// 没有nextUpdate的crl只缓存和使用defaultCRLCacheTTL
+	checker = NewCertRevocationChecker(HardFail)
+	crlServer.Close()
+	e := newCRLEntry(&x509.RevocationList{ThisUpdate: now.Add(-time.Minute)}, now)
+	if !e.expiry.Equal(now.Add(defaultCRLCacheTTL)) {
+		t.Fatal(e.expiry)
+	}
+	checker.crl[crlServer.URL] = e
+	cached, err := checker.fetchCRL(crlServer.URL, now.Add(defaultCRLCacheTTL-time.Second))
+	if err != nil || cached != e {
+		t.Fatal(err)
+	}
+	_, err = checker.fetchCRL(crlServer.URL, now.Add(defaultCRLCacheTTL))
+	if err == nil {
+		t.FailNow()
+	}
+}
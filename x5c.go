@@ -0,0 +1,134 @@
+package jwt
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+)
+
+var (
+	ErrInvalidCertificate = errors.New("invalid certificate")
+	ErrNoTrustedRoots     = errors.New("no trusted roots")
+)
+
+// 签名时带上证书链，chain[0]是签名key的证书，后面是中间证书，
+// 同时设置x5t#S256
+func (h Header) SetX5C(chain ...*x509.Certificate) {
+	x5c := make([]string, len(chain))
+	for i, c := range chain {
+		x5c[i] = base64.StdEncoding.EncodeToString(c.Raw)
+	}
+	h["x5c"] = x5c
+	if len(chain) > 0 {
+		h["x5t#S256"] = certThumbprint(chain[0])
+	}
+}
+
+// roots不能是nil或者空，否则x509会使用系统的根证书，
+// 任何公共ca签发的证书都可以签名
+func NewX5CVerifier(roots *x509.CertPool) (*X5CVerifier, error) {
+	if !hasRoots(roots) {
+		return nil, ErrNoTrustedRoots
+	}
+	v := new(X5CVerifier)
+	v.Roots = roots
+	return v, nil
+}
+
+func hasRoots(roots *x509.CertPool) bool {
+	return roots != nil && !roots.Equal(x509.NewCertPool())
+}
+
+// 使用header.x5c的证书验证token，不需要预先共享公钥
+type X5CVerifier struct {
+	Roots     *x509.CertPool     // 信任的根证书，不能是nil或者空
+	KeyUsages []x509.ExtKeyUsage // 叶子证书的扩展用途，空表示任意
+	Config    *Config            // 证书有效期使用它的时间，nil使用DefaultConfig
+	// 不为nil，检查证书链的吊销状态
+	Revocation *CertRevocationChecker
+}
+
+// 验证签名和证书链
+func (v *X5CVerifier) Verify(token string) (header, payload Claims, err error) {
+	return VerifyWithKeyFunc(token, v.KeyFunc, v.Config)
+}
+
+// 实现KeyFunc，验证证书链，返回叶子证书的公钥
+func (v *X5CVerifier) KeyFunc(header Claims) (interface{}, error) {
+	leaf, _, err := v.VerifyChain(header)
+	if err != nil {
+		return nil, err
+	}
+	return leaf.PublicKey, nil
+}
+
+// 解析header.x5c，验证x5t#S256，用途和有效期，然后验证到根证书的链
+func (v *X5CVerifier) VerifyChain(header Claims) (*x509.Certificate, [][]*x509.Certificate, error) {
+	if !hasRoots(v.Roots) {
+		return nil, nil, ErrNoTrustedRoots
+	}
+	certs, err := parseX5C(header)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaf := certs[0]
+	if x5t, ok := header["x5t#S256"]; ok && x5t != certThumbprint(leaf) {
+		return nil, nil, ErrInvalidCertificate
+	}
+	// 用途必须包括签名
+	if leaf.KeyUsage != 0 && leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return nil, nil, ErrInvalidCertificate
+	}
+	config := v.Config
+	if config == nil {
+		config = DefaultConfig
+	}
+	opts := x509.VerifyOptions{
+		Roots:         v.Roots,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   config.now(),
+		KeyUsages:     v.KeyUsages,
+	}
+	if len(opts.KeyUsages) < 1 {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	for _, c := range certs[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	chains, err := leaf.Verify(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v.Revocation != nil {
+		err = v.Revocation.Check(chains[0], opts.CurrentTime)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return leaf, chains, nil
+}
+
+// header.x5c是标准base64的der数组
+func parseX5C(header Claims) ([]*x509.Certificate, error) {
+	x5c, ok := header["x5c"].([]interface{})
+	if !ok || len(x5c) < 1 {
+		return nil, ErrInvalidCertificate
+	}
+	certs := make([]*x509.Certificate, 0, len(x5c))
+	for _, v := range x5c {
+		s, ok := v.(string)
+		if !ok {
+			return nil, ErrInvalidCertificate
+		}
+		der, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, ErrInvalidCertificate
+		}
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}